@@ -0,0 +1,126 @@
+package cmdexec
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"errors"
+	"fmt"
+)
+
+//Format of archive with multiple output files
+type ArchiveFormat uint8
+
+const (
+	ArchiveZip ArchiveFormat = iota
+	ArchiveTar
+	ArchiveTarGzip
+)
+
+//walks through regular files and directories in the specified root directory.
+//Symbolic links and special files are skipped so nothing outside of the root can be archived
+func walkDirectory(root string, visit func(path string, name string, info os.FileInfo) error) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		} else if path == root || !(info.Mode().IsRegular() || info.IsDir()) {
+			return nil
+		} else if name, err := filepath.Rel(root, path); err == nil {
+			return visit(path, filepath.ToSlash(name), info)
+		} else {
+			return err
+		}
+	})
+}
+
+func copyFile(path string, output io.Writer) error {
+	if file, err := os.Open(path); err == nil {
+		defer file.Close()
+		_, err = io.Copy(output, file)
+		return err
+	} else {
+		return err
+	}
+}
+
+func writeZip(root string, output io.Writer) error {
+	archive := zip.NewWriter(output)
+	err := walkDirectory(root, func(path string, name string, info os.FileInfo) error {
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		if info.IsDir() {
+			header.Name += "/"
+			_, err = archive.CreateHeader(header)
+			return err
+		}
+		header.Method = zip.Deflate
+		if entry, err := archive.CreateHeader(header); err == nil {
+			return copyFile(path, entry)
+		} else {
+			return err
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+func writeTar(root string, output io.Writer) error {
+	archive := tar.NewWriter(output)
+	err := walkDirectory(root, func(path string, name string, info os.FileInfo) error {
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		} else if info.IsDir() {
+			return nil
+		} else {
+			return copyFile(path, archive)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+func writeTarGzip(root string, output io.Writer) error {
+	compressor := gzip.NewWriter(output)
+	if err := writeTar(root, compressor); err != nil {
+		return err
+	}
+	return compressor.Close()
+}
+
+//Creates recorder which provides content of the directory packed into archive
+func NewArchiveRecorder(directory string, format ArchiveFormat) (ExecutionResultRecorder, error) {
+	var write func(string, io.Writer) error
+	switch format {
+	case ArchiveZip:
+		write = writeZip
+	case ArchiveTar:
+		write = writeTar
+	case ArchiveTarGzip:
+		write = writeTarGzip
+	default:
+		return nil, errors.New(fmt.Sprintf("Unsupported archive format %v", format))
+	}
+	if recorder, err := NewTempFileRecorder(true); err != nil {
+		return nil, err
+	} else if err := write(directory, recorder); err == nil {
+		return recorder, nil
+	} else {
+		recorder.Close()
+		return nil, err
+	}
+}
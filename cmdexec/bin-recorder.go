@@ -39,6 +39,23 @@ func (self *fileRecorder) WriteTo(output io.Writer) (int64, error) {
 	return io.Copy(output, &self.file)
 }
 
+//Reads recorded content at the specified offset without changing position in the file
+func (self *fileRecorder) ReadAt(p []byte, offset int64) (int, error) {
+	return self.file.ReadAt(p, offset)
+}
+
+//Creates recorder which provides content of the existing file
+func NewFileRecorder(fileName string, deleteOnClose bool) (ExecutionResultRecorder, error) {
+	if file, err := os.Open(fileName); err != nil {
+		return nil, err
+	} else if info, err := file.Stat(); err == nil {
+		return &fileRecorder{file: *file, deleteOnClose: deleteOnClose, written: int(info.Size())}, nil
+	} else {
+		file.Close()
+		return nil, err
+	}
+}
+
 func NewTempFileRecorder(deleteOnClose bool) (ExecutionResultRecorder, error) {
 	if file, err := NewTempFile(); err == nil {
 		return &fileRecorder{file: *file, deleteOnClose: deleteOnClose}, nil
@@ -2,18 +2,35 @@ package cmdexec
 
 import (
 	"os/exec"
+	"os"
+	"fmt"
 	"io"
 	"log"
+	"time"
+	"context"
+	"sync/atomic"
 )
 
 type ExecutionErrorCode uint8
 
+//Exit code reported when process was killed because of expired timeout
+const ExitCodeTimeout = -2
+
+//Time given to the process for graceful termination before it will be killed
+var TerminationGracePeriod = 5 * time.Second
+
+//Maximum number of bytes captured from the end of stderr
+var MaxStderrSize = 64 * 1024
+
 //Arguments for command execution
 type Arguments map[string]interface{}
 
 //Execution error code
 type ExecutionError struct {
 	ProcessExitCode int
+	Command string	//name of the executed program
+	Stage int	//index of the failed command in the pipeline
+	stages int	//number of commands in the pipeline
 	stderr []byte
 }
 
@@ -22,8 +39,10 @@ type CommandRenderer func(Arguments) (*exec.Cmd, error)
 
 //Execute command-line tool and write result into writer
 //To simplify interpretation of execution result you can use ExecutionResultRecorder interface
-//and its default implementations
-type CommandExecutor func(Arguments, io.Writer) error
+//and its default implementations.
+//Reader is connected to stdin of the process, it may be nil.
+//The process is terminated when context is cancelled
+type CommandExecutor func(context.Context, Arguments, io.Reader, io.Writer) error
 
 //Used to record result of command execution and interpret this result
 type ExecutionResultRecorder interface {
@@ -37,35 +56,183 @@ type ExecutionResultRecorder interface {
 
 //Creates default command executor
 func NewCommandExecutor(render CommandRenderer) CommandExecutor{
-	if render == nil{
-		log.Panicf("Command renderer is not specified")
+	return NewTimeoutCommandExecutor(render, 0)
+}
+
+//Creates command executor which terminates the process and all its children
+//if execution takes more than specified timeout. Zero timeout means no deadline
+func NewTimeoutCommandExecutor(render CommandRenderer, timeout time.Duration) CommandExecutor {
+	return NewPipelineExecutor([]CommandRenderer{render}, timeout)
+}
+
+//Creates command executor which pipes stdout of each command into stdin of the next command.
+//Execution error describes the first failed command in the pipeline
+func NewPipelineExecutor(pipeline []CommandRenderer, timeout time.Duration) CommandExecutor {
+	if len(pipeline) == 0 {
+		log.Panicf("Pipeline is empty")
+	}
+	for _, render := range pipeline {
+		if render == nil {
+			log.Panicf("Command renderer is not specified")
+		}
 	}
-	return func(args Arguments, output io.Writer) error {
-		if cmd, err := render(args); err == nil {
-			log.Printf("Running command %v", cmd.Args)
-			cmd.Stdout = output
-			if err := cmd.Run(); err == nil{
-				return nil
+	return func(ctx context.Context, args Arguments, input io.Reader, output io.Writer) error {
+		cmds := make([]*exec.Cmd, len(pipeline))
+		for index, render := range pipeline {
+			if cmd, err := render(args); err == nil {
+				log.Printf("Running command %v", cmd.Args)
+				cmds[index] = cmd
 			} else {
-				switch e := err.(type) {
-				case *exec.ExitError:
-					return convertToError(e)
-				default:
-					return e
-				}
+				return err
 			}
+		}
+		if first := cmds[0]; input != nil {
+			first.Stdin = input
+			//process may exit without reading the whole input
+			first.WaitDelay = TerminationGracePeriod
+		}
+		cmds[len(cmds) - 1].Stdout = output
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return run(ctx, cmds)
+	}
+}
+
+func closeAll(closers []io.Closer) {
+	for _, closer := range closers {
+		closer.Close()
+	}
+}
+
+//connects stdout of each command with stdin of the next command.
+//Returns ends of the pipes which should be closed by the parent process after start of commands
+func connectPipeline(pipeline []*exec.Cmd) ([]io.Closer, error) {
+	pipes := make([]io.Closer, 0, 2 * (len(pipeline) - 1))
+	for index := 1; index < len(pipeline); index++ {
+		if reader, writer, err := os.Pipe(); err == nil {
+			pipeline[index - 1].Stdout = writer
+			pipeline[index].Stdin = reader
+			pipes = append(pipes, reader, writer)
 		} else {
+			closeAll(pipes)
+			return nil, err
+		}
+	}
+	return pipes, nil
+}
+
+//starts all commands of the pipeline. Already started commands are killed if one of them cannot be started
+func start(pipeline []*exec.Cmd) error {
+	if pipes, err := connectPipeline(pipeline); err == nil {
+		defer closeAll(pipes)	//parent process doesn't need the pipes
+	} else {
+		return err
+	}
+	for index, cmd := range pipeline {
+		if err := cmd.Start(); err != nil {
+			for _, started := range pipeline[:index] {
+				killProcessGroup(started)
+				started.Wait()
+			}
 			return err
 		}
 	}
+	return nil
+}
+
+func succeeded(err error) bool {
+	return err == nil || err == exec.ErrWaitDelay
+}
+
+//runs the pipeline of commands and terminates their process groups when context is done
+func run(ctx context.Context, pipeline []*exec.Cmd) error {
+	stderr := make([]*tailBuffer, len(pipeline))
+	for index, cmd := range pipeline {
+		setProcessGroup(cmd)
+		stderr[index] = newTailBuffer(MaxStderrSize)
+		cmd.Stderr = stderr[index]
+	}
+	if err := start(pipeline); err != nil {
+		return err
+	}
+	completed := make(chan struct{})
+	gracePeriod := TerminationGracePeriod
+	var terminated int32	//commands are terminated because context is done, otherwise they failed by themselves
+	go func() {
+		select {
+		case <-ctx.Done():
+			atomic.StoreInt32(&terminated, 1)
+			for _, cmd := range pipeline {
+				log.Printf("Terminating command %v. Reason: %s", cmd.Args, ctx.Err())
+				terminateProcessGroup(cmd)
+			}
+			//kill the process if it ignores termination request
+			select {
+			case <-time.After(gracePeriod):
+				for _, cmd := range pipeline {
+					log.Printf("Killing command %v", cmd.Args)
+					killProcessGroup(cmd)
+				}
+			case <-completed:
+			}
+		case <-completed:
+		}
+	}()
+	errs := make([]error, len(pipeline))
+	for index, cmd := range pipeline {
+		errs[index] = cmd.Wait()
+	}
+	close(completed)
+	//find the first failed command
+	for index, err := range errs {
+		cmd := pipeline[index]
+		if succeeded(err) { //unread input is discarded
+			continue
+		} else if e, ok := err.(*exec.ExitError); ok && isBrokenPipe(e) && index < len(pipeline) - 1 {
+			continue //the next command exited before reading the whole output, e.g. 'head', its own result is reported instead
+		} else if atomic.LoadInt32(&terminated) == 1 && ctx.Err() == context.DeadlineExceeded {
+			return &ExecutionError{ProcessExitCode: ExitCodeTimeout, Command: cmd.Args[0], Stage: index, stages: len(pipeline), stderr: stderr[index].Bytes()}
+		} else if atomic.LoadInt32(&terminated) == 1 {
+			return ctx.Err()
+		}
+		switch e := err.(type) {
+		case *exec.ExitError:
+			result := convertToError(e)
+			result.Command = cmd.Args[0]
+			result.Stage = index
+			result.stages = len(pipeline)
+			result.stderr = stderr[index].Bytes()
+			return result
+		default:
+			return e
+		}
+	}
+	return nil
 }
 
 /* ExecutionError */
+
+//Returns content of standard error stream of the process
+func (self *ExecutionError) Stderr() string {
+	return string(self.stderr)
+}
+
 func (self* ExecutionError) Error() string {
-	if self.stderr != nil && len(self.stderr) > 0 {
-		return string(self.stderr)
+	var message string
+	if self.ProcessExitCode == ExitCodeTimeout {
+		message = "Process was killed because of timeout"
+	} else if self.stderr != nil && len(self.stderr) > 0 {
+		message = string(self.stderr)
+	} else {
+		message = exitCodeToString(self.ProcessExitCode)
+	}
+	if self.stages > 1 {
+		return fmt.Sprintf("Command %s at stage %v of the pipeline is failed: %s", self.Command, self.Stage, message)
 	} else {
-		return exitCodeToString(self.ProcessExitCode)
+		return message
 	}
 }
 
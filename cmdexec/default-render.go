@@ -30,6 +30,39 @@ func NewDefaultRenderer(name string, text string) (CommandRenderer, error) {
 	}
 }
 
+//Creates command renderer from the list of templates.
+//Each template is rendered into exactly one argument of the command
+//so the argument value is never split or unquoted
+func NewArgvRenderer(argv []string) (CommandRenderer, error) {
+	if len(argv) < 1 {
+		return nil, errors.New("Command is empty")
+	}
+	templates := make([]*template.Template, len(argv))
+	for index, text := range argv {
+		if tpl, err := template.New(argv[0]).Parse(text); err == nil {
+			templates[index] = tpl
+		} else {
+			return nil, err
+		}
+	}
+	renderer := func(args Arguments) (*exec.Cmd, error) {
+		result := make([]string, len(templates))
+		for index, tpl := range templates {
+			buf := new(bytes.Buffer)
+			if err := tpl.Execute(buf, args); err == nil {
+				result[index] = buf.String()
+			} else {
+				return nil, err
+			}
+		}
+		if len(result[0]) == 0 {
+			return nil, errors.New("Program name is empty")
+		}
+		return exec.Command(result[0], result[1:]...), nil
+	}
+	return renderer, nil
+}
+
 func NewAutoNamedRenderer(text string) (CommandRenderer, error) {
 	switch patternName := strings.Fields(text); len(patternName) {
 	case 0:
@@ -0,0 +1,30 @@
+package cmdexec
+
+import (
+	"text/template"
+	"os/exec"
+	"bytes"
+)
+
+//Creates command renderer which runs the process in the specified working directory.
+//Directory is a template rendered using command arguments
+func NewWorkingDirectoryRenderer(render CommandRenderer, directory string) (CommandRenderer, error) {
+	if tpl, err := template.New("workingDirectory").Parse(directory); err == nil {
+		renderer := func(args Arguments) (*exec.Cmd, error) {
+			if cmd, err := render(args); err == nil {
+				buf := new(bytes.Buffer)
+				if err := tpl.Execute(buf, args); err == nil {
+					cmd.Dir = buf.String()
+					return cmd, nil
+				} else {
+					return nil, err
+				}
+			} else {
+				return nil, err
+			}
+		}
+		return renderer, nil
+	} else {
+		return nil, err
+	}
+}
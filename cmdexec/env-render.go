@@ -0,0 +1,52 @@
+package cmdexec
+
+import (
+	"text/template"
+	"os/exec"
+	"os"
+	"bytes"
+)
+
+//Creates command renderer which passes environment variables to the process.
+//Values of the variables are templates rendered using command arguments.
+//If inherit is nil then the process inherits the whole environment of the server,
+//otherwise only listed variables are inherited
+func NewEnvironmentRenderer(render CommandRenderer, environment map[string]string, inherit []string) (CommandRenderer, error) {
+	templates := make(map[string]*template.Template, len(environment))
+	for name, text := range environment {
+		if tpl, err := template.New(name).Parse(text); err == nil {
+			templates[name] = tpl
+		} else {
+			return nil, err
+		}
+	}
+	renderer := func(args Arguments) (*exec.Cmd, error) {
+		if cmd, err := render(args); err == nil {
+			var env []string
+			if inherit == nil {
+				env = os.Environ()
+			} else {
+				env = make([]string, 0, len(inherit) + len(templates))
+				for _, name := range inherit {
+					if value, ok := os.LookupEnv(name); ok {
+						env = append(env, name + "=" + value)
+					}
+				}
+			}
+			//rendered variables override inherited variables
+			for name, tpl := range templates {
+				buf := new(bytes.Buffer)
+				if err := tpl.Execute(buf, args); err == nil {
+					env = append(env, name + "=" + buf.String())
+				} else {
+					return nil, err
+				}
+			}
+			cmd.Env = env
+			return cmd, nil
+		} else {
+			return nil, err
+		}
+	}
+	return renderer, nil
+}
@@ -3,6 +3,12 @@ package cmdexec
 import (
 	"testing"
 	"bytes"
+	"time"
+	"context"
+	"os"
+	"io/ioutil"
+	"path/filepath"
+	"archive/zip"
 )
 
 func TestCommandRendering(test *testing.T){
@@ -20,6 +26,20 @@ func TestCommandRendering(test *testing.T){
 	}
 }
 
+func TestArgvRendering(test *testing.T) {
+	renderer, err := NewArgvRenderer([]string{"echo", "-n", "{{.message}}"})
+	if err != nil {
+		test.Fatal(err)
+	}
+	cmd, err := renderer(NewArguments().SetString("message", "Hello \"world\" -e"))
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(cmd.Args) != 3 || cmd.Args[2] != "Hello \"world\" -e" {
+		test.Fatalf("Unexpected args %v", cmd.Args)
+	}
+}
+
 func readAll(result ExecutionResultRecorder) ([]byte, error) {
 	buf := new(bytes.Buffer)
 	_, err := result.WriteTo(buf)
@@ -35,7 +55,7 @@ func TestTextExecution(test *testing.T) {
 	args := NewArguments().SetString("message", "Hello, world!")
 	result := NewTextRecorder()
 	defer result.Close()
-	if err := executor(args, result); err != nil {
+	if err := executor(context.Background(), args, nil, result); err != nil {
 		test.Fatal(err)
 	}
 
@@ -53,10 +73,217 @@ func TestFileExecution(test *testing.T) {
 	args := NewArguments().SetString("message", "Hello, world!")
 	result, _ := NewTempFileRecorder(true)
 	defer result.Close()
-	if err := executor(args, result); err != nil {
+	if err := executor(context.Background(), args, nil, result); err != nil {
 		test.Fatal(err)
 	}
 	if out, err := readAll(result); err != nil || string(out) != "Hello, world!\n" {
 		test.Fatal("Unexpected stdout")
 	}
-}
\ No newline at end of file
+}
+
+func TestExecutionTimeout(test *testing.T) {
+	//child process inherits stdout so the whole process group should be killed
+	renderer, err := NewDefaultRenderer("sh", "sh -c \"sleep 10 | cat\"")
+	if err != nil {
+		test.Fatal(err)
+	}
+	executor := NewTimeoutCommandExecutor(renderer, 100 * time.Millisecond)
+	result := NewTextRecorder()
+	defer result.Close()
+	start := time.Now()
+	switch err := executor(context.Background(), NewArguments(), nil, result).(type) {
+	case *ExecutionError:
+		if err.ProcessExitCode != ExitCodeTimeout {
+			test.Fatalf("Unexpected exit code %v", err.ProcessExitCode)
+		}
+	default:
+		test.Fatalf("Unexpected execution result %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5 * time.Second {
+		test.Fatalf("Process group was not killed in time: %v", elapsed)
+	}
+}
+
+func TestExecutionCancellation(test *testing.T) {
+	//process ignores SIGTERM so it should be killed after grace period
+	renderer, err := NewDefaultRenderer("sh", "sh -c \"trap '' TERM; sleep 10\"")
+	if err != nil {
+		test.Fatal(err)
+	}
+	gracePeriod := TerminationGracePeriod
+	TerminationGracePeriod = 100 * time.Millisecond
+	defer func() { TerminationGracePeriod = gracePeriod }()
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100 * time.Millisecond, cancel)
+	result := NewTextRecorder()
+	defer result.Close()
+	start := time.Now()
+	if err := NewCommandExecutor(renderer)(ctx, NewArguments(), nil, result); err != context.Canceled {
+		test.Fatalf("Unexpected execution result %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5 * time.Second {
+		test.Fatalf("Process was not killed in time: %v", elapsed)
+	}
+}
+
+func TestStderrCapture(test *testing.T) {
+	renderer, err := NewDefaultRenderer("sh", "sh -c \"echo oops >&2; exit 3\"")
+	if err != nil {
+		test.Fatal(err)
+	}
+	result := NewTextRecorder()
+	defer result.Close()
+	switch err := NewCommandExecutor(renderer)(context.Background(), NewArguments(), nil, result).(type) {
+	case *ExecutionError:
+		if err.ProcessExitCode != 3 || err.Stderr() != "oops\n" || err.Command != "sh" {
+			test.Fatalf("Unexpected error %+v", err)
+		}
+	default:
+		test.Fatalf("Unexpected execution result %v", err)
+	}
+}
+
+func TestTailBuffer(test *testing.T) {
+	buffer := newTailBuffer(4)
+	buffer.Write([]byte("ab"))
+	buffer.Write([]byte("cde"))
+	if string(buffer.Bytes()) != "bcde" {
+		test.Fatalf("Unexpected content %s", buffer.Bytes())
+	}
+	buffer.Write([]byte("0123456"))
+	if string(buffer.Bytes()) != "3456" {
+		test.Fatalf("Unexpected content %s", buffer.Bytes())
+	}
+}
+
+func TestStdin(test *testing.T) {
+	renderer, err := NewDefaultRenderer("sort", "sort")
+	if err != nil {
+		test.Fatal(err)
+	}
+	result := NewTextRecorder()
+	defer result.Close()
+	if err := NewCommandExecutor(renderer)(context.Background(), NewArguments(), bytes.NewBufferString("b\na\n"), result); err != nil {
+		test.Fatal(err)
+	}
+	if out, err := readAll(result); err != nil || string(out) != "a\nb\n" {
+		test.Fatalf("Unexpected stdout %s", out)
+	}
+}
+
+func TestPipeline(test *testing.T) {
+	first, _ := NewArgvRenderer([]string{"printf", "b\na\nb\n"})
+	second, _ := NewDefaultRenderer("sort", "sort")
+	third, _ := NewDefaultRenderer("uniq", "uniq -c")
+	result := NewTextRecorder()
+	defer result.Close()
+	if err := NewPipelineExecutor([]CommandRenderer{first, second, third}, 0)(context.Background(), NewArguments(), nil, result); err != nil {
+		test.Fatal(err)
+	}
+	if out, err := readAll(result); err != nil || len(bytes.Fields(out)) != 4 {
+		test.Fatalf("Unexpected stdout %s", out)
+	}
+}
+
+func TestPipelineFailure(test *testing.T) {
+	first, _ := NewDefaultRenderer("echo", "echo Hello")
+	second, _ := NewDefaultRenderer("sh", "sh -c \"cat; exit 4\"")
+	third, _ := NewDefaultRenderer("cat", "cat")
+	result := NewTextRecorder()
+	defer result.Close()
+	switch err := NewPipelineExecutor([]CommandRenderer{first, second, third}, 0)(context.Background(), NewArguments(), nil, result).(type) {
+	case *ExecutionError:
+		if err.ProcessExitCode != 4 || err.Stage != 1 || err.Command != "sh" {
+			test.Fatalf("Unexpected error %v at stage %v", err.ProcessExitCode, err.Stage)
+		}
+	default:
+		test.Fatalf("Unexpected execution result %v", err)
+	}
+	if out, err := readAll(result); err != nil || string(out) != "Hello\n" {
+		test.Fatalf("Unexpected stdout %s", out)
+	}
+}
+
+func TestPipelineBrokenPipe(test *testing.T) {
+	//producer is killed by SIGPIPE when the consumer exits early
+	first, _ := NewDefaultRenderer("yes", "yes")
+	second, _ := NewDefaultRenderer("head", "head -n 1")
+	result := NewTextRecorder()
+	defer result.Close()
+	if err := NewPipelineExecutor([]CommandRenderer{first, second}, 0)(context.Background(), NewArguments(), nil, result); err != nil {
+		test.Fatal(err)
+	}
+	if out, err := readAll(result); err != nil || string(out) != "y\n" {
+		test.Fatalf("Unexpected stdout %s", out)
+	}
+}
+
+func TestPipelineBrokenPipeFailure(test *testing.T) {
+	//failure of the consumer is reported instead of SIGPIPE of the producer
+	first, _ := NewDefaultRenderer("yes", "yes")
+	second, _ := NewDefaultRenderer("sh", "sh -c \"head -n 1; exit 3\"")
+	result := NewTextRecorder()
+	defer result.Close()
+	switch err := NewPipelineExecutor([]CommandRenderer{first, second}, 0)(context.Background(), NewArguments(), nil, result).(type) {
+	case *ExecutionError:
+		if err.ProcessExitCode != 3 || err.Stage != 1 || err.Command != "sh" {
+			test.Fatalf("Unexpected error %v at stage %v", err.ProcessExitCode, err.Stage)
+		}
+	default:
+		test.Fatalf("Unexpected execution result %v", err)
+	}
+}
+
+func TestPipelineTimeout(test *testing.T) {
+	first, _ := NewDefaultRenderer("sleep", "sleep 10")
+	second, _ := NewDefaultRenderer("cat", "cat")
+	result := NewTextRecorder()
+	defer result.Close()
+	switch err := NewPipelineExecutor([]CommandRenderer{first, second}, 100 * time.Millisecond)(context.Background(), NewArguments(), nil, result).(type) {
+	case *ExecutionError:
+		if err.ProcessExitCode != ExitCodeTimeout || err.Error() != "Command sleep at stage 0 of the pipeline is failed: Process was killed because of timeout" {
+			test.Fatalf("Unexpected error %s", err.Error())
+		}
+	default:
+		test.Fatalf("Unexpected execution result %v", err)
+	}
+}
+
+func TestEnvironment(test *testing.T) {
+	os.Setenv("GO2REST_SECRET", "secret")
+	defer os.Unsetenv("GO2REST_SECRET")
+	renderer, _ := NewDefaultRenderer("sh", "sh -c \"echo $GO2REST_SECRET$GO2REST_REGION\"")
+	renderer, err := NewEnvironmentRenderer(renderer, map[string]string{"GO2REST_REGION": "{{.region}}"}, []string{"PATH"})
+	if err != nil {
+		test.Fatal(err)
+	}
+	result := NewTextRecorder()
+	defer result.Close()
+	if err := NewCommandExecutor(renderer)(context.Background(), NewArguments().SetString("region", "eu"), nil, result); err != nil {
+		test.Fatal(err)
+	}
+	if out, err := readAll(result); err != nil || string(out) != "eu\n" {
+		test.Fatalf("Unexpected stdout %s", out)
+	}
+}
+
+func TestArchiveRecorder(test *testing.T) {
+	directory, err := NewTempDir()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	os.Mkdir(filepath.Join(directory, "logs"), 0700)
+	ioutil.WriteFile(filepath.Join(directory, "logs", "build.log"), []byte("done"), 0600)
+	result, err := NewArchiveRecorder(directory, ArchiveZip)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer result.Close()
+	content, _ := readAll(result)
+	if archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content))); err != nil {
+		test.Fatal(err)
+	} else if len(archive.File) != 2 || archive.File[1].Name != "logs/build.log" {
+		test.Fatalf("Unexpected content of archive %v", archive.File)
+	}
+}
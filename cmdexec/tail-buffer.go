@@ -0,0 +1,28 @@
+package cmdexec
+
+//buffer which keeps only the last portion of written data
+type tailBuffer struct {
+	limit int
+	data []byte
+}
+
+func newTailBuffer(limit int) *tailBuffer {
+	return &tailBuffer{limit: limit, data: make([]byte, 0, 512)}
+}
+
+func (self *tailBuffer) Write(p []byte) (int, error) {
+	if len(p) >= self.limit {
+		self.data = append(self.data[:0], p[len(p) - self.limit:]...)
+	} else {
+		self.data = append(self.data, p...)
+		if overflow := len(self.data) - self.limit; overflow > 0 {
+			copy(self.data, self.data[overflow:])
+			self.data = self.data[:self.limit]
+		}
+	}
+	return len(p), nil
+}
+
+func (self *tailBuffer) Bytes() []byte {
+	return self.data
+}
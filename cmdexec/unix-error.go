@@ -21,4 +21,9 @@ func convertToError(err* exec.ExitError) *ExecutionError {
 
 func exitCodeToString(exitCode int) string{
 	return fmt.Sprintf("Process was exited with code %v", exitCode)
-}
\ No newline at end of file
+}
+//indicates that the process was killed by SIGPIPE because the next command of the pipeline stopped reading its output
+func isBrokenPipe(err *exec.ExitError) bool {
+	ws, ok := err.Sys().(syscall.WaitStatus)
+	return ok && ws.Signaled() && ws.Signal() == syscall.SIGPIPE
+}
@@ -0,0 +1,26 @@
+//+build linux darwin
+
+package cmdexec
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+//places the process into its own process group so it can be killed together with its children
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = new(syscall.SysProcAttr)
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+func terminateProcessGroup(cmd *exec.Cmd) error {
+	//negative PID means process group
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	//negative PID means process group
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -24,6 +24,17 @@ func NewTempFile() (*os.File, error) {
 	}
 }
 
+//Creates a new temporary file with name matching the pattern.
+//The last '*' in the pattern is replaced by random string
+func NewTempFilePattern(pattern string) (*os.File, error) {
+	return ioutil.TempFile("", tempFilePrefix + pattern)
+}
+
+//Creates a new temporary directory
+func NewTempDir() (string, error) {
+	return ioutil.TempDir("", tempFilePrefix)
+}
+
 func parseCommandLine(command string) []string {
 	type ParserState uint8
 	const stateStart = ParserState(0)
@@ -77,4 +77,9 @@ func exitCodeToString(exitCode int) string{
 	default:
 		return fmt.Sprintf("Process was exited with code %v", exitCode)
 	}
-}
\ No newline at end of file
+}
+
+//Windows has no SIGPIPE, writer of the broken pipe receives an error instead
+func isBrokenPipe(err *exec.ExitError) bool {
+	return false
+}
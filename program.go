@@ -7,15 +7,20 @@ import (
 	"path"
 	"github.com/sakno/go2rest/rest"
 	"github.com/sakno/go2rest/rest/raml"
+	"github.com/sakno/go2rest/rest/openapi"
 	"github.com/sakno/go2rest/hosting"
 	"fmt"
+	"time"
+	"errors"
+	"io/ioutil"
 )
 
-func startRestService(model rest.Model, address, certFile, keyFile string) {
+func startRestService(model rest.Model, address, certFile, keyFile, openAPIPath string) {
 	var server hosting.Server
 	if len(address) == 0 {
 		fcgi := new(rest.FastCGI)
 		fcgi.Model = model
+		fcgi.OpenAPIPath = openAPIPath
 		server = fcgi
 		log.Printf("Starting FastCGI process")
 	} else {
@@ -24,6 +29,7 @@ func startRestService(model rest.Model, address, certFile, keyFile string) {
 		rest.KeyFile = keyFile
 		rest.CertFile = certFile
 		rest.Model = model
+		rest.OpenAPIPath = openAPIPath
 		server = rest
 		log.Printf("Starting standalone server at %s", address)
 	}
@@ -31,32 +37,67 @@ func startRestService(model rest.Model, address, certFile, keyFile string) {
 	log.Printf("Unable to run server. Reason: %s", err.Error())
 }
 
-func run(fileName, address, certFile, keyFile string) {
+//overlays and extensions are applied to RAML model in the specified order
+func readModel(fileName string, extensions []string, timeout time.Duration) (rest.Model, error) {
 	switch extension := path.Ext(fileName); extension {
 	case ".raml":
 		model := new(raml.Model)
-		if err := model.ReadModelFromFile(fileName); err == nil {
-			startRestService(model, address, certFile, keyFile)
-		} else {
-			log.Fatalf("Failed to read RAML file %s. Error: %s", fileName, err.Error())
+		model.DefaultTimeout = timeout
+		return model, model.ReadModelFromFile(fileName, extensions...)
+	case ".yaml", ".yml", ".json":
+		if len(extensions) > 0 {
+			return nil, errors.New("Overlays and extensions are supported by RAML model only")
 		}
+		model := new(openapi.Model)
+		model.DefaultTimeout = timeout
+		return model, model.ReadModelFromFile(fileName)
 	default:
-		log.Fatalf("Unsupported API description format: %s", extension)
+		return nil, errors.New(fmt.Sprintf("Unsupported API description format: %s", extension))
+	}
+}
+
+func run(fileName string, extensions []string, address, certFile, keyFile, openAPIPath string, timeout time.Duration) {
+	if model, err := readModel(fileName, extensions, timeout); err == nil {
+		startRestService(model, address, certFile, keyFile, openAPIPath)
+	} else {
+		log.Fatalf("Failed to read model %s. Error: %s", fileName, err.Error())
+	}
+}
+
+//reports all problems of the model, one per line. Exit code is non-zero if the model is invalid
+func validate(fileName string, extensions []string) {
+	log.SetOutput(ioutil.Discard)	//parsing progress is not interesting here
+	if _, err := readModel(fileName, extensions, 0); err == nil {
+		fmt.Fprintf(os.Stdout, "%s: OK\n", fileName)
+	} else {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
 	}
 }
 
 func main() {
 	flags := flag.NewFlagSet("rest2go", flag.ExitOnError)
 	flags.SetOutput(os.Stdout)
-	var port, certFile, keyFile string
+	var port, certFile, keyFile, openAPIPath string
+	var timeout time.Duration
 	flags.StringVar(&port, "port", "http", "TCP port to listen on")
 	flags.StringVar(&certFile, "cert", "", "Absolute path to certificate file")
 	flags.StringVar(&keyFile, "key", "", "Absolute path to key file")
+	flags.DurationVar(&timeout, "timeout", 0, "Default execution timeout of command-line tool, e.g. 30s. Zero means no timeout")
+	flags.StringVar(&openAPIPath, "openapi", "", "Path of route with generated OpenAPI document, e.g. /openapi.json")
+	flags.IntVar(&rest.MaxJobs, "max-jobs", rest.MaxJobs, "Maximum number of asynchronous jobs including completed jobs. Zero means no limit")
 	if len(os.Args) == 1 {
-		fmt.Fprintln(os.Stdout, "go2rest [-port port-number] [-cert path/to/x509/cert] [-key path/to/cert/key] <path/to/model>")
+		fmt.Fprintln(os.Stdout, "go2rest [-port port-number] [-cert path/to/x509/cert] [-key path/to/cert/key] [-timeout duration] [-openapi /route/path] [-max-jobs number] <path/to/model> [path/to/overlay...]")
+		fmt.Fprintln(os.Stdout, "go2rest validate <path/to/model> [path/to/overlay...]")
 		flags.PrintDefaults()
+	} else if os.Args[1] == "validate" {
+		if len(os.Args) < 3 {
+			fmt.Fprintln(os.Stderr, "Path to model is not specified")
+			os.Exit(2)
+		}
+		validate(os.Args[2], os.Args[3:])
 	} else {
 		flags.Parse(os.Args[1:])
-		run(flags.Arg(0), port, certFile, keyFile)
+		run(flags.Arg(0), flags.Args()[1:], port, certFile, keyFile, openAPIPath, timeout)
 	}
 }
\ No newline at end of file
@@ -0,0 +1,177 @@
+package rest
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"encoding/json"
+	"strings"
+	"log"
+)
+
+const openAPIVersion = "3.0.3"
+
+//Model that provides base URL of REST service
+type baseUrlProvider interface {
+	BaseUrl() *url.URL
+}
+
+//converts parameter into JSON schema
+func exportSchema(parameter Parameter) map[string]interface{} {
+	schema := make(map[string]interface{})
+	switch parameter := parameter.(type) {
+	case IntegerParameter:
+		schema["type"] = "integer"
+		if parameter.HasDefaultValue() {
+			schema["default"] = parameter.DefaultValue()
+		}
+	case NumberParameter:
+		schema["type"] = "number"
+		if parameter.HasDefaultValue() {
+			schema["default"] = parameter.DefaultValue()
+		}
+	case StringParameter:
+		schema["type"] = "string"
+		if parameter.HasDefaultValue() {
+			schema["default"] = parameter.DefaultValue()
+		}
+	case BoolParameter:
+		schema["type"] = "boolean"
+		if parameter.HasDefaultValue() {
+			schema["default"] = parameter.DefaultValue()
+		}
+	case FileParameter:
+		schema["type"] = "string"
+		schema["format"] = "binary"
+	case ArrayParameter:
+		schema["type"] = "array"
+		schema["items"] = exportSchema(parameter.ElementType())
+	case ObjectParameter:
+		schema["type"] = "object"
+		properties := make(map[string]interface{})
+		required := make([]string, 0)
+		for name, field := range parameter.Fields() {
+			properties[name] = exportSchema(field)
+			if field.Required() {
+				required = append(required, name)
+			}
+		}
+		schema["properties"] = properties
+		if !parameter.AdditionalProperties() {
+			schema["additionalProperties"] = false
+		}
+		if len(required) > 0 {
+			sort.Strings(required)
+			schema["required"] = required
+		}
+	case UnionParameter:
+		members := make([]interface{}, len(parameter.Members()))
+		for index, member := range parameter.Members() {
+			members[index] = exportSchema(member)
+		}
+		schema["anyOf"] = members
+	}
+	return schema
+}
+
+func exportParameters(parameters ParameterList, location string, output []interface{}) []interface{} {
+	names := make([]string, 0, len(parameters))
+	for name := range parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		parameter := parameters[name]
+		output = append(output, map[string]interface{}{
+			"name":     name,
+			"in":       location,
+			"required": location == "path" || parameter.Required(),
+			"schema":   exportSchema(parameter),
+		})
+	}
+	return output
+}
+
+func exportOperation(method HttpMethodDescriptor) map[string]interface{} {
+	operation := make(map[string]interface{})
+	parameters := exportParameters(method.QueryParameters(), "query", make([]interface{}, 0))
+	parameters = exportParameters(method.RequestHeaders(), "header", parameters)
+	if len(parameters) > 0 {
+		operation["parameters"] = parameters
+	}
+	//request body
+	if len(method.Request()) > 0 {
+		content := make(map[string]interface{})
+		required := false
+		for mimeType, body := range method.Request() {
+			content[mimeType] = map[string]interface{}{"schema": exportSchema(body)}
+			required = required || body.Required()
+		}
+		operation["requestBody"] = map[string]interface{}{"content": content, "required": required}
+	}
+	//responses ordered by exit code so the first exit code wins in case of duplicated status code
+	exitCodes := make([]int, 0, len(method.Response()))
+	for exitCode := range method.Response() {
+		exitCodes = append(exitCodes, exitCode)
+	}
+	sort.Ints(exitCodes)
+	responses := make(map[string]interface{})
+	for _, exitCode := range exitCodes {
+		response := method.Response()[exitCode]
+		statusCode := strconv.Itoa(response.StatusCode)
+		if _, exists := responses[statusCode]; exists {
+			log.Printf("Exit code %v is not exported because status code %s is already mapped", exitCode, statusCode)
+			continue
+		}
+		//exit codes are internal details of the service as well as commands
+		description := map[string]interface{}{"description": http.StatusText(response.StatusCode)}
+		if response.Body != nil && len(response.MimeType) > 0 {
+			description["content"] = map[string]interface{}{
+				response.MimeType: map[string]interface{}{"schema": exportSchema(response.Body)},
+			}
+		}
+		responses[statusCode] = description
+	}
+	operation["responses"] = responses
+	return operation
+}
+
+//Generates OpenAPI 3 document from any REST model.
+//The document can be serialized into JSON
+func ExportOpenAPI(model Model) map[string]interface{} {
+	paths := make(map[string]interface{})
+	for path, endpoint := range model.Endpoints() {
+		item := make(map[string]interface{})
+		if parameters := exportParameters(endpoint.PathParameters(), "path", make([]interface{}, 0)); len(parameters) > 0 {
+			item["parameters"] = parameters
+		}
+		for _, method := range getAllowedMethods(endpoint) {
+			item[strings.ToLower(method)] = exportOperation(endpoint.GetMethodDescriptor(method))
+		}
+		paths[path] = item
+	}
+	document := map[string]interface{}{
+		"openapi": openAPIVersion,
+		"info":    map[string]interface{}{"title": model.Name(), "version": "1.0"},
+		"paths":   paths,
+	}
+	if model, ok := model.(baseUrlProvider); ok && model.BaseUrl() != nil {
+		document["servers"] = []interface{}{map[string]interface{}{"url": model.BaseUrl().String()}}
+	}
+	return document
+}
+
+//creates HTTP handler which returns OpenAPI document describing the model
+func createOpenAPIHandler(model Model) http.HandlerFunc {
+	document, err := json.Marshal(ExportOpenAPI(model))
+	return func(response http.ResponseWriter, request *http.Request) {
+		if err == nil {
+			response.Header().Set(headerContentType, "application/json")
+			response.Header().Set(headerContentLength, strconv.Itoa(len(document)))
+			response.Write(document)
+		} else {
+			writeError(err, request, response)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 type FastCGI struct {
 	Model Model
+	OpenAPIPath string	//path of built-in route with OpenAPI document. Empty string to disable the route
 }
 
 func (self *FastCGI) Close() error {
@@ -16,7 +17,7 @@ func (self *FastCGI) Close() error {
 
 func (self *FastCGI) Run(async bool) error {
 	router := mux.NewRouter()
-	prepareRouter(router, self.Model)
+	prepareRouter(router, self.Model, self.OpenAPIPath)
 	if async {
 		return errors.New("asynchronous launch is not supported")
 	} else {
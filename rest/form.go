@@ -0,0 +1,121 @@
+package rest
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	mimeMultipart = "multipart/form-data"
+	mimeURLEncoded = "application/x-www-form-urlencoded"
+)
+
+//saves value of parsed form field into arguments
+func (self *requestContext) setFormValue(name string, parameter Parameter, value interface{}) error {
+	switch value := value.(type) {
+	case *os.File:
+		//for file we need to pass file name only
+		fileName := value.Name()
+		value.Close()
+		self.args[name] = fileName
+		self.Defer(func() { os.Remove(fileName) })	//ensure that temporary file will be deleted
+		return nil
+	default:
+		if parameter.Validate(value) {
+			self.args[name] = value
+			return nil
+		} else {
+			return newParameterProblem(name, http.StatusBadRequest, fmt.Sprintf("Argument %s has invalid value %v", name, value))
+		}
+	}
+}
+
+//checks that all required form fields are specified and sets default values of missing fields
+func (self *requestContext) completeForm(fields ParameterList, received map[string]bool) error {
+	for name, parameter := range fields {
+		if received[name] {
+			continue
+		} else if parameter.HasDefaultValue() {
+			setDefaultValue(name, parameter, self.args)
+		} else if parameter.Required() {
+			return newParameterProblem(name, http.StatusBadRequest, fmt.Sprintf("Parameter %s is required but not specified in actual request", name))
+		}
+	}
+	return nil
+}
+
+//parses multipart/form-data body where each part is a named field of the object.
+//File parts are saved into temporary files, other parts are parsed as text
+func (self *requestContext) parseMultipartForm(body ObjectParameter) error {
+	reader, err := self.MultipartReader()
+	if err != nil {
+		return newParameterProblem(TemplateParamBody, http.StatusBadRequest, err.Error())
+	}
+	fields := body.Fields()
+	received := make(map[string]bool)	//parts of this body, arguments from query or headers can have the same names
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return newParameterProblem(TemplateParamBody, http.StatusBadRequest, err.Error())
+		}
+		name := part.FormName()
+		if parameter, exists := fields[name]; !exists && !body.AdditionalProperties() {
+			part.Close()
+			return newParameterProblem(name, http.StatusBadRequest, fmt.Sprintf("Argument %s is not declared", name))
+		} else if !exists {
+			log.Printf("Unexpected part %s of multipart request %s %s is ignored", name, self.Method, self.URL)
+		} else if received[name] {
+			part.Close()
+			return newParameterProblem(name, http.StatusBadRequest, fmt.Sprintf("Argument %s is specified more than once", name))
+		} else {
+			received[name] = true
+			format := FormatText
+			if _, ok := parameter.(FileParameter); ok {
+				format = FormatBinary
+			}
+			value, err := parameter.ReadValue(part, format)
+			if err == nil {
+				err = self.setFormValue(name, parameter, value)
+			} else {
+				err = newParameterProblem(name, http.StatusBadRequest, fmt.Sprintf("Argument %s has invalid format. Error: %s", name, err.Error()))
+			}
+			if err != nil {
+				part.Close()
+				return err
+			}
+		}
+		part.Close()
+	}
+	return self.completeForm(fields, received)
+}
+
+
+func extractFormFields(request *http.Request) map[string]string {
+	result := make(map[string]string, len(request.PostForm))
+	for name, values := range request.PostForm {
+		result[name] = strings.Join(values, ",")
+	}
+	return result
+}
+
+//parses application/x-www-form-urlencoded body where each field is a separate argument
+func (self *requestContext) parseURLEncodedForm(body ObjectParameter) error {
+	if err := self.ParseForm(); err != nil {
+		return newParameterProblem(TemplateParamBody, http.StatusBadRequest, err.Error())
+	}
+	fields := body.Fields()
+	if !body.AdditionalProperties() {
+		for name := range self.PostForm {
+			if _, exists := fields[name]; !exists {
+				return newParameterProblem(name, http.StatusBadRequest, fmt.Sprintf("Argument %s is not declared", name))
+			}
+		}
+	}
+	return self.parseArguments(fields, extractFormFields)
+}
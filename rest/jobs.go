@@ -0,0 +1,346 @@
+package rest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"github.com/gorilla/mux"
+	"github.com/sakno/go2rest/cmdexec"
+	"github.com/sakno/go2rest/core"
+)
+
+const (
+	jobsPath = "/jobs"
+	headerLocation = "Location"
+	jobIdVar = "id"
+	//job states
+	jobRunning = "running"
+	jobSucceeded = "succeeded"
+	jobFailed = "failed"
+	jobCancelled = "cancelled"
+	//time during which results of completed job are available
+	jobRetention = time.Hour
+)
+
+//Maximum number of jobs kept by the server including completed jobs. Zero means no limit
+var MaxJobs = 100
+
+var errTooManyJobs = errors.New("Too many jobs")
+
+//Represents asynchronous execution of command-line tool
+type job struct {
+	sync.Mutex
+	id string
+	mimeType string	//MIME type of stdout
+	stdout cmdexec.ExecutionResultRecorder
+	cancel context.CancelFunc
+	completed chan struct{}
+	err error
+	cancelled bool
+	deferredActions []core.DeferredAction
+}
+
+//Describes state of the job in HTTP response
+type jobStatus struct {
+	Id string `json:"id"`
+	Status string `json:"status"`
+	ExitCode *int `json:"exitCode,omitempty"`
+	Error string `json:"error,omitempty"`
+	Stdout string `json:"stdout"`
+	Stderr string `json:"stderr"`
+}
+
+func (self *job) finalize() {
+	for _, action := range self.deferredActions {
+		action()
+	}
+}
+
+func (self *job) run(executor cmdexec.CommandExecutor, ctx context.Context, args cmdexec.Arguments, stdin io.Reader, collect outputCollector) {
+	defer close(self.completed)
+	err := executor(ctx, args, stdin, self.stdout)
+	if err == nil && collect != nil { //output of the job is produced by the process instead of stdout
+		if output, e := collect(); e == nil {
+			self.Lock()
+			self.stdout.Close()
+			self.stdout = output
+			self.Unlock()
+		} else {
+			err = e
+		}
+	}
+	//temporary resources associated with the request are not needed anymore
+	self.finalize()
+	self.Lock()
+	self.err = err
+	self.Unlock()
+	log.Printf("Job %s is completed", self.id)
+}
+
+func (self *job) isCompleted() bool {
+	select {
+	case <-self.completed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (self *job) status() *jobStatus {
+	result := &jobStatus{
+		Id: self.id,
+		Status: jobRunning,
+		Stdout: jobsPath + "/" + self.id + "/stdout",
+		Stderr: jobsPath + "/" + self.id + "/stderr",
+	}
+	if self.isCompleted() {
+		self.Lock()
+		defer self.Unlock()
+		exitCode := 0
+		switch err := self.err.(type) {
+		case nil:
+			result.Status = jobSucceeded
+		case *cmdexec.ExecutionError:
+			result.Status = jobFailed
+			exitCode = err.ProcessExitCode
+			result.Error = err.Error()
+		default:
+			result.Status = jobFailed
+			exitCode = -1
+			result.Error = err.Error()
+		}
+		if self.cancelled {
+			result.Status = jobCancelled
+		}
+		result.ExitCode = &exitCode
+	}
+	return result
+}
+
+//Set of asynchronous jobs
+type jobRegistry struct {
+	sync.Mutex
+	jobs map[string]*job
+	maxJobs int	//zero means no limit
+}
+
+func newJobRegistry(maxJobs int) *jobRegistry {
+	return &jobRegistry{jobs: make(map[string]*job), maxJobs: maxJobs}
+}
+
+func newJobId() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err == nil {
+		return hex.EncodeToString(id), nil
+	} else {
+		return "", err
+	}
+}
+
+//starts execution of command in background.
+//Job takes ownership of deferred actions because temporary resources should live until the end of execution
+func (self *jobRegistry) start(executor cmdexec.CommandExecutor, args cmdexec.Arguments, stdin io.Reader, mimeType string, collect outputCollector, deferredActions []core.DeferredAction) (*job, error) {
+	id, err := newJobId()
+	if err != nil {
+		return nil, err
+	}
+	//the limit is checked together with registration so concurrent requests can't exceed it
+	self.Lock()
+	defer self.Unlock()
+	if self.maxJobs > 0 && len(self.jobs) >= self.maxJobs {
+		return nil, errTooManyJobs
+	}
+	stdout, err := cmdexec.NewTempFileRecorder(true)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	result := &job{id: id, mimeType: mimeType, stdout: stdout, cancel: cancel, completed: make(chan struct{}), deferredActions: deferredActions}
+	self.jobs[id] = result
+	log.Printf("Starting job %s", id)
+	go func() {
+		result.run(executor, ctx, args, stdin, collect)
+		//results of the job are not needed after retention period
+		time.AfterFunc(jobRetention, func() { self.remove(id) })
+	}()
+	return result, nil
+}
+
+func (self *jobRegistry) get(id string) *job {
+	self.Lock()
+	defer self.Unlock()
+	return self.jobs[id]
+}
+
+//cancels the running job
+func (self *job) terminate() {
+	self.Lock()
+	self.cancelled = true
+	self.Unlock()
+	self.cancel()
+	<-self.completed
+}
+
+//cancels the job and releases all its resources
+func (self *jobRegistry) remove(id string) bool {
+	self.Lock()
+	result, exists := self.jobs[id]
+	delete(self.jobs, id)
+	self.Unlock()
+	if exists {
+		if !result.isCompleted() {
+			result.terminate()
+		}
+		result.Lock()
+		result.stdout.Close()
+		result.Unlock()
+		log.Printf("Job %s is removed", id)
+	}
+	return exists
+}
+
+func writeJobStatus(status *jobStatus, statusCode int, request *http.Request, response http.ResponseWriter) {
+	if content, err := json.Marshal(status); err == nil {
+		response.Header().Set(headerContentType, "application/json")
+		response.Header().Set(headerContentLength, strconv.Itoa(len(content)))
+		response.WriteHeader(statusCode)
+		response.Write(content)
+	} else {
+		writeError(err, request, response)
+	}
+}
+
+//saves request body into temporary file because the job outlives the request
+func (self *requestContext) bufferStdin() (io.Reader, error) {
+	if self.stdin == nil {
+		return nil, nil
+	} else if file, err := cmdexec.NewTempFile(); err == nil {
+		fileName := file.Name()
+		self.Defer(func() {
+			file.Close()
+			os.Remove(fileName)
+		})
+		if _, err := io.Copy(file, self.stdin); err != nil {
+			return nil, err
+		} else if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return file, nil
+	} else {
+		return nil, err
+	}
+}
+
+//executes command in background and returns location of the job
+func (self *requestContext) startJob(method HttpMethodDescriptor, successResponse ResponseDescriptor, collect outputCollector, response http.ResponseWriter) {
+	if self.jobs == nil {
+		writeError(newProblem(http.StatusInternalServerError, "Asynchronous execution is not supported"), self.Request, response)
+	} else if stdin, err := self.bufferStdin(); err != nil {
+		writeError(err, self.Request, response)
+	} else if job, err := self.jobs.start(method.Executor(), self.args, stdin, successResponse.MimeType, collect, self.deferredActions); err == nil {
+		self.deferredActions = nil
+		response.Header().Set(headerLocation, jobsPath + "/" + job.id)
+		writeJobStatus(job.status(), http.StatusAccepted, self.Request, response)
+	} else if err == errTooManyJobs {
+		writeError(newProblem(http.StatusServiceUnavailable, "Maximum number of jobs is reached. Remove completed jobs and try again"), self.Request, response)
+	} else {
+		writeError(err, self.Request, response)
+	}
+}
+
+func (self *jobRegistry) handleStatus(response http.ResponseWriter, request *http.Request) {
+	if job := self.get(mux.Vars(request)[jobIdVar]); job == nil {
+		writeError(newProblem(http.StatusNotFound, "Job doesn't exist"), request, response)
+	} else {
+		writeJobStatus(job.status(), http.StatusOK, request, response)
+	}
+}
+
+//cancels running job or removes completed job
+func (self *jobRegistry) handleDelete(response http.ResponseWriter, request *http.Request) {
+	id := mux.Vars(request)[jobIdVar]
+	if job := self.get(id); job == nil {
+		writeError(newProblem(http.StatusNotFound, "Job doesn't exist"), request, response)
+	} else if !job.isCompleted() {
+		job.terminate()
+		writeJobStatus(job.status(), http.StatusOK, request, response)
+	} else if self.remove(id) {
+		response.WriteHeader(http.StatusNoContent)
+	} else {
+		writeError(newProblem(http.StatusNotFound, "Job doesn't exist"), request, response)
+	}
+}
+
+func (self *jobRegistry) handleStdout(response http.ResponseWriter, request *http.Request) {
+	if job := self.get(mux.Vars(request)[jobIdVar]); job == nil {
+		writeError(newProblem(http.StatusNotFound, "Job doesn't exist"), request, response)
+	} else if !job.isCompleted() {
+		writeError(newProblem(http.StatusConflict, "Job is still running"), request, response)
+	} else {
+		job.Lock()
+		stdout := job.stdout
+		job.Unlock()
+		response.Header().Set(headerContentType, job.mimeType)
+		response.Header().Set(headerContentLength, strconv.Itoa(stdout.Len()))
+		response.WriteHeader(http.StatusOK)
+		if reader, ok := stdout.(io.ReaderAt); ok {
+			//each download has its own position in the file so slow client doesn't block others
+			io.Copy(response, io.NewSectionReader(reader, 0, int64(stdout.Len())))
+		} else {
+			//concurrent downloads share position of the recorder
+			job.Lock()
+			defer job.Unlock()
+			stdout.WriteTo(response)
+		}
+	}
+}
+
+func (self *jobRegistry) handleStderr(response http.ResponseWriter, request *http.Request) {
+	if job := self.get(mux.Vars(request)[jobIdVar]); job == nil {
+		writeError(newProblem(http.StatusNotFound, "Job doesn't exist"), request, response)
+	} else if !job.isCompleted() {
+		writeError(newProblem(http.StatusConflict, "Job is still running"), request, response)
+	} else {
+		job.Lock()
+		defer job.Unlock()
+		stderr := ""
+		if err, ok := job.err.(*cmdexec.ExecutionError); ok {
+			stderr = err.Stderr()
+		}
+		response.Header().Set(headerContentType, "text/plain")
+		response.Header().Set(headerContentLength, strconv.Itoa(len(stderr)))
+		response.WriteHeader(http.StatusOK)
+		response.Write([]byte(stderr))
+	}
+}
+
+//registers routes used to control asynchronous jobs
+func (self *jobRegistry) register(router *mux.Router) {
+	log.Printf("Jobs are available at %s", jobsPath)
+	jobPath := jobsPath + "/{" + jobIdVar + "}"
+	router.NewRoute().Path(jobPath).Methods(http.MethodGet).HandlerFunc(self.handleStatus)
+	router.NewRoute().Path(jobPath).Methods(http.MethodDelete).HandlerFunc(self.handleDelete)
+	router.NewRoute().Path(jobPath + "/stdout").Methods(http.MethodGet).HandlerFunc(self.handleStdout)
+	router.NewRoute().Path(jobPath + "/stderr").Methods(http.MethodGet).HandlerFunc(self.handleStderr)
+}
+
+//indicates that at least one method of the model is executed asynchronously
+func hasAsyncMethods(model Model) bool {
+	for _, endpoint := range model.Endpoints() {
+		for _, method := range getAllowedMethods(endpoint) {
+			if endpoint.GetMethodDescriptor(method).HasOption(OptionAsync) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -60,6 +60,28 @@ func GetFormatByMIME(mediaType string) ParameterValueFormat {
 	}
 }
 
+//Returns format of archive associated with the media type
+func GetArchiveFormatByMIME(mediaType string) (cmdexec.ArchiveFormat, bool) {
+	switch mediaType {
+	case "application/zip":
+		return cmdexec.ArchiveZip, true
+	case "application/x-tar":
+		return cmdexec.ArchiveTar, true
+	case "application/gzip", "application/x-gzip", "application/x-gtar":
+		return cmdexec.ArchiveTarGzip, true
+	default:
+		return 0, false
+	}
+}
+
+//Well-known options of model elements
+const (
+	OptionStreaming = "streaming"	//output of the process is written into HTTP response without buffering
+	OptionAsync = "async"	//process is executed in background and its result is available through job API
+	OptionStdin = "stdin"	//request body is streamed into stdin of the process
+	OptionSandbox = "sandbox"	//temporary working directory is created for each request
+)
+
 //Represents model element
 type ModelElement interface {
 	//Indicates that custom option is defined for model element
@@ -119,6 +141,13 @@ type ArrayParameter interface {
 type ObjectParameter interface {
 	Parameter
 	Fields() ParameterList
+	AdditionalProperties() bool	//object may contain fields which are not declared in the model
+}
+
+//Represents parameter which value matches to at least one of the member types
+type UnionParameter interface {
+	Parameter
+	Members() []Parameter
 }
 
 //Describes response associated with exit code
@@ -126,6 +155,9 @@ type ResponseDescriptor struct {
 	Body Parameter	//response parameter description
 	StatusCode int	//HTTP status code
 	MimeType string	//MIME type
+	ErrorDetails bool	//error is rendered as JSON with exit code, tail of stderr and command name
+	OutputFile string	//pattern of name of the file produced by the process which is used as response body instead of stdout, e.g. "*.jpg". Empty string means stdout
+	OutputDirectory bool	//files produced by the process in the output directory are packed into archive and used as response body
 }
 
 //Describes HTTP method
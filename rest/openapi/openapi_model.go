@@ -0,0 +1,623 @@
+package openapi
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"strconv"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"net/textproto"
+	"time"
+	"gopkg.in/yaml.v2"
+	"github.com/sakno/go2rest/cmdexec"
+	"github.com/sakno/go2rest/rest"
+	"github.com/sakno/go2rest/rest/raml"
+)
+
+const (
+	//OpenAPI fields
+	fOpenAPI              = "openapi"
+	fInfo                 = "info"
+	fTitle                = "title"
+	fServers              = "servers"
+	fUrl                  = "url"
+	fPaths                = "paths"
+	fParameters           = "parameters"
+	fName                 = "name"
+	fIn                   = "in"
+	fRequired             = "required"
+	fSchema               = "schema"
+	fRequestBody          = "requestBody"
+	fContent              = "content"
+	fResponses            = "responses"
+	fRef                  = "$ref"
+	fType                 = "type"
+	fFormat               = "format"
+	fItems                = "items"
+	fProperties           = "properties"
+	fAdditionalProperties = "additionalProperties"
+	//OpenAPI extensions
+	extensionPrefix     = "x-"
+	fCommandPattern     = "x-command-pattern"
+	fCommand            = "x-command"
+	fPipeline           = "x-pipeline"
+	fEnvironment        = "x-environment"
+	fInheritEnvironment = "x-inherit-environment"
+	fWorkingDirectory   = "x-working-directory"
+	fExitCode           = "x-exit-code"
+	fTimeout            = "x-timeout"
+	fErrorDetails       = "x-error-details"
+	fOutputFile         = "x-output-file"
+	fOutputDirectory    = "x-output-directory"
+	//parameter locations
+	inPath   = "path"
+	inQuery  = "query"
+	inHeader = "header"
+	inCookie = "cookie"
+	//JSON schema types
+	tString = "string"
+	tArray  = "array"
+	tObject = "object"
+	//types understood by RAML parameter parser
+	tFile = "file"
+	tAny  = "any"
+	//maximum depth of $ref chain
+	maxRefDepth = 32
+)
+
+//facets of JSON schema with the same meaning in RAML
+var compatibleFacets = []string{"default", "pattern", "minimum", "maximum", "minLength", "maxLength", "minItems", "maxItems"}
+
+//options of the operation which can be enabled by boolean extensions such as 'x-streaming: true'
+var operationOptions = map[string]bool{rest.OptionStreaming: true, rest.OptionAsync: true, rest.OptionStdin: true}
+
+//mapping between keys of Path Item Object and HTTP methods
+var operations = map[string]string{
+	"get":     http.MethodGet,
+	"put":     http.MethodPut,
+	"post":    http.MethodPost,
+	"delete":  http.MethodDelete,
+	"options": http.MethodOptions,
+	"head":    http.MethodHead,
+	"patch":   http.MethodPatch,
+}
+
+//extensions which describe command-line tool
+var commandFields = rest.CommandFields{Command: fCommand, CommandPattern: fCommandPattern, Pipeline: fPipeline, Environment: fEnvironment, InheritEnvironment: fInheritEnvironment, WorkingDirectory: fWorkingDirectory}
+
+//converts fields of the tree into map expected by helpers shared with other model readers
+func toMap(tree yaml.MapSlice) map[string]interface{} {
+	result := make(map[string]interface{}, len(tree))
+	for _, item := range tree {
+		if name, ok := item.Key.(string); ok {
+			result[name] = item.Value
+		}
+	}
+	return result
+}
+
+func lookup(tree yaml.MapSlice, key string) (interface{}, bool) {
+	for _, item := range tree {
+		if item.Key == key {
+			return item.Value, true
+		}
+	}
+	return nil, false
+}
+
+func toBool(value interface{}) bool {
+	switch value {
+	case true, "true":
+		return true
+	default:
+		return false
+	}
+}
+
+//parameter declared in the model with its location
+type parameterDescriptor struct {
+	name      string
+	location  string
+	parameter rest.Parameter
+}
+
+type MethodDescriptor struct {
+	queryParameters rest.ParameterList
+	reqHeaders      rest.ParameterList
+	request         rest.ParameterList
+	responses       map[int]rest.ResponseDescriptor
+	executor        cmdexec.CommandExecutor
+	options         map[string]bool
+}
+
+func newMethodDescriptor() *MethodDescriptor {
+	return &MethodDescriptor{
+		queryParameters: make(rest.ParameterList),
+		reqHeaders:      make(rest.ParameterList),
+		request:         make(rest.ParameterList),
+		responses:       make(map[int]rest.ResponseDescriptor),
+		options:         make(map[string]bool),
+	}
+}
+
+func (self *MethodDescriptor) HasOption(name string) bool {
+	return self.options[name]
+}
+
+func (self *MethodDescriptor) Executor() cmdexec.CommandExecutor {
+	return self.executor
+}
+
+func (self *MethodDescriptor) QueryParameters() rest.ParameterList {
+	return self.queryParameters
+}
+
+func (self *MethodDescriptor) RequestHeaders() rest.ParameterList {
+	return self.reqHeaders
+}
+
+func (self *MethodDescriptor) Request() rest.ParameterList {
+	return self.request
+}
+
+func (self *MethodDescriptor) Response() map[int]rest.ResponseDescriptor {
+	return self.responses
+}
+
+//Represents endpoint described by Path Item Object
+type Endpoint struct {
+	pathParameters rest.ParameterList
+	methods        map[string]*MethodDescriptor
+}
+
+func (self *Endpoint) HasOption(name string) bool {
+	return false
+}
+
+func (self *Endpoint) PathParameters() rest.ParameterList {
+	return self.pathParameters
+}
+
+func (self *Endpoint) GetMethodDescriptor(method string) rest.HttpMethodDescriptor {
+	if method, ok := self.methods[method]; ok {
+		return method
+	} else {
+		return nil
+	}
+}
+
+//binds parameters to the endpoint and method according with their location
+func (self *Endpoint) bind(parameters []parameterDescriptor, method *MethodDescriptor) error {
+	for _, descriptor := range parameters {
+		switch descriptor.location {
+		case inPath:
+			self.pathParameters[descriptor.name] = descriptor.parameter
+		case inQuery:
+			method.queryParameters[descriptor.name] = descriptor.parameter
+		case inHeader:
+			method.reqHeaders[textproto.CanonicalMIMEHeaderKey(descriptor.name)] = descriptor.parameter
+		case inCookie:
+			log.Printf("Cookie parameter %s is ignored because cookies are not passed to the command", descriptor.name)
+		default:
+			return errors.New(fmt.Sprintf("Unsupported location %s of parameter %s", descriptor.location, descriptor.name))
+		}
+	}
+	return nil
+}
+
+//Represents REST model restored from OpenAPI 3 document
+type Model struct {
+	DefaultTimeout time.Duration //execution timeout of operations without x-timeout extension. Zero means no timeout
+	title     string
+	baseUri   *url.URL
+	endpoints map[string]rest.Endpoint
+	root      yaml.MapSlice
+}
+
+func (self *Model) Endpoints() map[string]rest.Endpoint {
+	return self.endpoints
+}
+
+func (self *Model) Name() string {
+	return self.title
+}
+
+func (self *Model) BaseUrl() *url.URL {
+	return self.baseUri
+}
+
+//resolves local reference in the form of JSON pointer
+func (self *Model) resolve(node interface{}) (yaml.MapSlice, error) {
+	for depth := 0; depth < maxRefDepth; depth++ {
+		tree, ok := node.(yaml.MapSlice)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("Unexpected tree type: %+v", node))
+		}
+		ref, ok := lookup(tree, fRef)
+		if !ok {
+			return tree, nil
+		}
+		pointer, ok := ref.(string)
+		if !ok || !strings.HasPrefix(pointer, "#/") {
+			return nil, errors.New(fmt.Sprintf("Only local references are supported: %v", ref))
+		}
+		node = self.root
+		for _, segment := range strings.Split(pointer[2:], "/") {
+			segment = strings.Replace(strings.Replace(segment, "~1", "/", -1), "~0", "~", -1)
+			if tree, ok := node.(yaml.MapSlice); ok {
+				if node, ok = lookup(tree, segment); !ok {
+					return nil, errors.New(fmt.Sprintf("Unresolved reference %s", pointer))
+				}
+			} else {
+				return nil, errors.New(fmt.Sprintf("Unresolved reference %s", pointer))
+			}
+		}
+	}
+	return nil, errors.New("Reference chain is too long")
+}
+
+//converts JSON schema into the description of parameter in terms of RAML facets
+func (self *Model) convertSchema(schema interface{}, required bool) (yaml.MapSlice, error) {
+	tree, err := self.resolve(schema)
+	if err != nil {
+		return nil, err
+	}
+	result := yaml.MapSlice{{Key: fRequired, Value: required}}
+	for _, facet := range compatibleFacets {
+		if value, ok := lookup(tree, facet); ok {
+			result = append(result, yaml.MapItem{Key: facet, Value: value})
+		}
+	}
+	schemaType, _ := lookup(tree, fType)
+	format, _ := lookup(tree, fFormat)
+	switch {
+	case schemaType == tString && format == "binary":
+		schemaType = tFile
+	case schemaType == tArray:
+		if items, ok := lookup(tree, fItems); ok {
+			if items, err := self.convertSchema(items, true); err == nil {
+				result = append(result, yaml.MapItem{Key: fItems, Value: items})
+			} else {
+				return nil, err
+			}
+		} else {
+			return nil, errors.New("Array schema has no items")
+		}
+	case schemaType == nil, schemaType == tObject:
+		if properties, ok := lookup(tree, fProperties); ok {
+			if properties, err := self.convertProperties(properties, tree); err == nil {
+				result = append(result, yaml.MapItem{Key: fProperties, Value: properties})
+				if additionalProperties, ok := lookup(tree, fAdditionalProperties); ok && additionalProperties == false {
+					result = append(result, yaml.MapItem{Key: fAdditionalProperties, Value: false})
+				}
+				schemaType = tObject
+			} else {
+				return nil, err
+			}
+		} else {
+			schemaType = tAny
+		}
+	}
+	return append(result, yaml.MapItem{Key: fType, Value: schemaType}), nil
+}
+
+//converts properties of object schema into RAML properties
+func (self *Model) convertProperties(properties interface{}, schema yaml.MapSlice) (yaml.MapSlice, error) {
+	requiredProperties := make(map[interface{}]bool)
+	if required, ok := lookup(schema, fRequired); ok {
+		if required, ok := required.([]interface{}); ok {
+			for _, name := range required {
+				requiredProperties[name] = true
+			}
+		}
+	}
+	if properties, ok := properties.(yaml.MapSlice); ok {
+		result := make(yaml.MapSlice, 0, len(properties))
+		for _, property := range properties {
+			if description, err := self.convertSchema(property.Value, requiredProperties[property.Key]); err == nil {
+				result = append(result, yaml.MapItem{Key: property.Key, Value: description})
+			} else {
+				return nil, err
+			}
+		}
+		return result, nil
+	} else {
+		return nil, errors.New(fmt.Sprintf("Properties of schema should be declared as map: %+v", properties))
+	}
+}
+
+//parameter of response body which is not described by schema
+func newStringParameter() rest.Parameter {
+	parameter, _ := raml.ParseParameter(yaml.MapSlice{{Key: fType, Value: tString}})
+	return parameter
+}
+
+func (self *Model) parseParameter(description interface{}, required bool) (rest.Parameter, error) {
+	if description == nil {
+		return raml.ParseParameter(yaml.MapSlice{{Key: fRequired, Value: required}, {Key: fType, Value: tAny}})
+	} else if description, err := self.convertSchema(description, required); err == nil {
+		return raml.ParseParameter(description)
+	} else {
+		return nil, err
+	}
+}
+
+func (self *Model) parseParameters(input interface{}) ([]parameterDescriptor, error) {
+	list, ok := input.([]interface{})
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Parameters should be declared as list: %+v", input))
+	}
+	result := make([]parameterDescriptor, 0, len(list))
+	for _, item := range list {
+		if tree, err := self.resolve(item); err == nil {
+			descriptor := parameterDescriptor{}
+			name, _ := lookup(tree, fName)
+			location, _ := lookup(tree, fIn)
+			if descriptor.name, ok = name.(string); !ok {
+				return nil, errors.New(fmt.Sprintf("Parameter has no name: %+v", item))
+			}
+			descriptor.location, _ = location.(string)
+			//path parameters are always required
+			required, _ := lookup(tree, fRequired)
+			schema, _ := lookup(tree, fSchema)
+			log.Printf("Start parsing parameter %s", descriptor.name)
+			if descriptor.parameter, err = self.parseParameter(schema, descriptor.location == inPath || toBool(required)); err != nil {
+				return nil, err
+			}
+			result = append(result, descriptor)
+		} else {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+//parses Content Object into the list of parameters bounded to MIME types
+func (self *Model) parseContent(content interface{}, required bool, output rest.ParameterList) error {
+	if content, ok := content.(yaml.MapSlice); ok {
+		for _, item := range content {
+			mimeType, _ := item.Key.(string)
+			mediaType, _ := item.Value.(yaml.MapSlice)
+			schema, _ := lookup(mediaType, fSchema)
+			if parameter, err := self.parseParameter(schema, required); err == nil {
+				output[mimeType] = parameter
+			} else {
+				return err
+			}
+		}
+		return nil
+	} else {
+		return errors.New(fmt.Sprintf("Unexpected tree type inside of content: %+v", content))
+	}
+}
+
+func toStatusCode(key interface{}) (int, bool) {
+	switch key := key.(type) {
+	case int:
+		return key, true
+	case string:
+		if statusCode, err := strconv.Atoi(key); err == nil {
+			return statusCode, true
+		}
+	}
+	return 0, false
+}
+
+func (self *Model) parseResponses(input interface{}, method *MethodDescriptor) error {
+	responses, ok := input.(yaml.MapSlice)
+	if !ok {
+		return errors.New(fmt.Sprintf("Description of responses is not valid: %+v", input))
+	}
+	for _, item := range responses {
+		statusCode, ok := toStatusCode(item.Key)
+		if !ok {
+			log.Printf("Response %v is ignored because it is not bound to exact status code", item.Key)
+			continue
+		}
+		response, err := self.resolve(item.Value)
+		if err != nil {
+			return err
+		}
+		exitCode, ok := lookup(response, fExitCode)
+		if !ok { //response is documented for clients only, e.g. error produced by proxy
+			log.Printf("Response %v is ignored because it is not bound to exit code", item.Key)
+			continue
+		} else if exitCode, ok := rest.ParseExitCode(exitCode); ok {
+			errorDetails, _ := lookup(response, fErrorDetails)
+			outputFile, _ := lookup(response, fOutputFile)
+			outputDirectory, _ := lookup(response, fOutputDirectory)
+			descriptor := rest.ResponseDescriptor{StatusCode: statusCode, MimeType: "text/plain", Body: newStringParameter(), ErrorDetails: toBool(errorDetails), OutputDirectory: toBool(outputDirectory)}
+			if descriptor.OutputFile, ok = rest.ParseOutputFile(outputFile); !ok {
+				return errors.New(fmt.Sprintf("Output file for status code %v has invalid value", statusCode))
+			}
+			if content, ok := lookup(response, fContent); ok {
+				body := make(rest.ParameterList)
+				if err := self.parseContent(content, true, body); err != nil {
+					return err
+				}
+				//first declared media type is used for response
+				for _, mediaType := range content.(yaml.MapSlice) {
+					descriptor.MimeType = mediaType.Key.(string)
+					descriptor.Body = body[descriptor.MimeType]
+					break
+				}
+			}
+			if err := rest.ValidateOutput(descriptor); err != nil {
+				return err
+			}
+			method.responses[exitCode] = descriptor
+		} else {
+			return errors.New(fmt.Sprintf("Exit code for status code %v has invalid value", statusCode))
+		}
+	}
+	return nil
+}
+
+func (self *Model) parseOperation(description interface{}, common []parameterDescriptor, endpoint *Endpoint) (*MethodDescriptor, error) {
+	tree, ok := description.(yaml.MapSlice)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Unrecognized description of operation: %+v", description))
+	}
+	method := newMethodDescriptor()
+	//boolean extensions such as 'x-streaming: true' are options of the operation. Other vendor extensions are ignored
+	for _, item := range tree {
+		if name, ok := item.Key.(string); ok && strings.HasPrefix(name, extensionPrefix) && operationOptions[strings.TrimPrefix(name, extensionPrefix)] && toBool(item.Value) {
+			method.options[strings.TrimPrefix(name, extensionPrefix)] = true
+		}
+	}
+	//parameters declared at path level can be overridden at operation level
+	if err := endpoint.bind(common, method); err != nil {
+		return nil, err
+	}
+	if parameters, ok := lookup(tree, fParameters); ok {
+		if parameters, err := self.parseParameters(parameters); err != nil {
+			return nil, err
+		} else if err := endpoint.bind(parameters, method); err != nil {
+			return nil, err
+		}
+	}
+	//parse request body
+	if requestBody, ok := lookup(tree, fRequestBody); ok {
+		if requestBody, err := self.resolve(requestBody); err == nil {
+			required, _ := lookup(requestBody, fRequired)
+			content, _ := lookup(requestBody, fContent)
+			if err := self.parseContent(content, toBool(required), method.request); err != nil {
+				return nil, err
+			}
+			for mimeType, body := range method.request {
+				if err := rest.ValidateRequestBody(mimeType, body); err != nil {
+					return nil, err
+				}
+			}
+		} else {
+			return nil, err
+		}
+	}
+	//parse timeout
+	timeout := self.DefaultTimeout
+	if value, ok := lookup(tree, fTimeout); ok {
+		var err error
+		if timeout, err = rest.ParseTimeout(value); err != nil {
+			return nil, err
+		}
+	}
+	//parse command pattern
+	fields := toMap(tree)
+	if pipeline, err := commandFields.ParsePipeline(fields); err != nil {
+		return nil, err
+	} else if err := commandFields.ParseEnvironment(fields, pipeline); err != nil {
+		return nil, err
+	} else if err := commandFields.ParseWorkingDirectory(fields, pipeline, method.options); err != nil {
+		return nil, err
+	} else {
+		method.executor = cmdexec.NewPipelineExecutor(pipeline, timeout)
+	}
+	//parse responses
+	if responses, ok := lookup(tree, fResponses); ok {
+		if err := self.parseResponses(responses, method); err != nil {
+			return nil, err
+		}
+	}
+	if len(method.responses) == 0 {
+		method.responses[0] = rest.ResponseDescriptor{StatusCode: 200, MimeType: "text/plain", Body: newStringParameter()}
+	}
+	return method, nil
+}
+
+func (self *Model) parseEndpoint(path string, description interface{}) error {
+	tree, ok := description.(yaml.MapSlice)
+	if !ok {
+		return errors.New(fmt.Sprintf("Unexpected tree type inside of path %s: %+v", path, description))
+	}
+	endpoint := &Endpoint{pathParameters: make(rest.ParameterList), methods: make(map[string]*MethodDescriptor)}
+	var common []parameterDescriptor
+	if parameters, ok := lookup(tree, fParameters); ok {
+		var err error
+		if common, err = self.parseParameters(parameters); err != nil {
+			return err
+		}
+	}
+	for _, item := range tree {
+		if key, ok := item.Key.(string); ok {
+			if httpMethod, ok := operations[key]; ok {
+				if method, err := self.parseOperation(item.Value, common, endpoint); err == nil {
+					endpoint.methods[httpMethod] = method
+				} else {
+					return errors.New(fmt.Sprintf("Failed to parse %s %s. Error: %s", httpMethod, path, err.Error()))
+				}
+			}
+		}
+	}
+	self.endpoints[path] = endpoint
+	return nil
+}
+
+func (self *Model) parse(document yaml.MapSlice) error {
+	self.root = document
+	self.endpoints = make(map[string]rest.Endpoint)
+	if version, ok := lookup(document, fOpenAPI); !ok || !strings.HasPrefix(fmt.Sprint(version), "3.") {
+		return errors.New(fmt.Sprintf("Unsupported version of OpenAPI specification: %v", version))
+	}
+	if info, ok := lookup(document, fInfo); ok {
+		if info, ok := info.(yaml.MapSlice); ok {
+			title, _ := lookup(info, fTitle)
+			self.title, _ = title.(string)
+		}
+	}
+	if servers, ok := lookup(document, fServers); ok {
+		if servers, ok := servers.([]interface{}); ok && len(servers) > 0 {
+			if server, ok := servers[0].(yaml.MapSlice); ok {
+				serverUrl, _ := lookup(server, fUrl)
+				if baseUri, err := url.Parse(fmt.Sprint(serverUrl)); err == nil {
+					self.baseUri = baseUri
+				} else {
+					log.Printf("Failed to parse server URL: %s", err.Error())
+				}
+			}
+		}
+	}
+	if paths, ok := lookup(document, fPaths); ok {
+		if paths, ok := paths.(yaml.MapSlice); ok {
+			for _, item := range paths {
+				if path, ok := item.Key.(string); ok {
+					log.Printf("Start parsing endpoint %s", path)
+					if err := self.parseEndpoint(path, item.Value); err != nil {
+						return err
+					}
+				}
+			}
+		} else {
+			return errors.New(fmt.Sprintf("Unexpected tree type inside of paths: %+v", paths))
+		}
+	}
+	return nil
+}
+
+//Read OpenAPI model in YAML or JSON format
+func (self *Model) ReadModel(input io.Reader) error {
+	if content, err := ioutil.ReadAll(input); err == nil {
+		document := yaml.MapSlice{}
+		if err := yaml.Unmarshal(content, &document); err == nil {
+			return self.parse(document)
+		} else {
+			return err
+		}
+	} else {
+		return err
+	}
+}
+
+//Read OpenAPI model from file
+func (self *Model) ReadModelFromFile(fileName string) error {
+	if file, err := os.Open(fileName); err == nil {
+		defer file.Close()
+		return self.ReadModel(file)
+	} else {
+		return err
+	}
+}
@@ -0,0 +1,287 @@
+package openapi
+
+import (
+	"testing"
+	"strings"
+	"net/http"
+	"encoding/json"
+	"github.com/sakno/go2rest/rest"
+)
+
+func testPathParameters(endpoint rest.Endpoint, t *testing.T) {
+	if parameter, ok := endpoint.PathParameters()["format"]; ok {
+		if _, ok := parameter.(rest.StringParameter); !ok {
+			t.Fatal("Incorrect type of 'format' parameter")
+		}
+		if !parameter.Required() {
+			t.Fatal("Path parameter is always required")
+		}
+	} else {
+		t.Fatal("'format' parameter missing")
+	}
+}
+
+func testGetMethod(endpoint rest.Endpoint, t *testing.T) {
+	method := endpoint.GetMethodDescriptor(http.MethodGet)
+	if method == nil {
+		t.Fatal("GET handler is not presented")
+	}
+	if endpoint.GetMethodDescriptor(http.MethodPost) != nil {
+		t.Fatal("POST handler is not expected")
+	}
+	//test query parameter declared at path level
+	if parameter, ok := method.QueryParameters()["int"]; ok {
+		if parameter, ok := parameter.(rest.IntegerParameter); ok {
+			if !(parameter.HasDefaultValue() && parameter.DefaultValue() == 100) {
+				t.Fatal("Default value test failed")
+			}
+			if parameter.Validate(201) {
+				t.Fatal("Range validation failed")
+			}
+		} else {
+			t.Fatal("Incorrect type of 'int' parameter")
+		}
+	} else {
+		t.Fatal("'int' parameter missing")
+	}
+	//test query parameter declared at operation level
+	if parameter, ok := method.QueryParameters()["search"]; ok {
+		if parameter, ok := parameter.(rest.ArrayParameter); !ok || !parameter.Required() {
+			t.Fatal("Incorrect declaration of 'search' parameter")
+		} else if _, ok := parameter.ElementType().(rest.StringParameter); !ok {
+			t.Fatal("Incorrect element type of 'search' parameter")
+		}
+	} else {
+		t.Fatal("'search' parameter missing")
+	}
+	//test headers
+	if header, ok := method.RequestHeaders()["X-Dept"]; ok {
+		if _, ok := header.(rest.IntegerParameter); !ok || header.Required() {
+			t.Fatal("Incorrect declaration of X-Dept header")
+		}
+	} else {
+		t.Fatal("Missing X-Dept header")
+	}
+	//test request body
+	if body, ok := method.Request()["application/octet-stream"]; ok {
+		if _, ok := body.(rest.FileParameter); !ok {
+			t.Fatal("Body has incorrect type")
+		}
+	} else {
+		t.Fatal("Request body missing")
+	}
+	if body, ok := method.Request()["multipart/form-data"].(rest.ObjectParameter); ok {
+		if dump, ok := body.Fields()["dump"].(rest.FileParameter); !ok || !dump.Required() {
+			t.Fatal("Incorrect declaration of 'dump' field")
+		} else if limit, ok := body.Fields()["limit"].(rest.IntegerParameter); !ok || limit.Required() {
+			t.Fatal("Incorrect declaration of 'limit' field")
+		}
+	} else {
+		t.Fatal("Multipart request body missing")
+	}
+	//test responses
+	if len(method.Response()) != 2 {
+		t.Fatalf("Unexpected number of responses %v", len(method.Response()))
+	}
+	if response := method.Response()[0]; response.StatusCode != 200 || response.MimeType != "application/json" {
+		t.Fatalf("Incorrect success response %+v", response)
+	} else if _, ok := response.Body.(rest.NumberParameter); !ok {
+		t.Fatal("Incorrect type of success response")
+	}
+	if response := method.Response()[-1]; response.StatusCode != 404 || response.MimeType != "text/plain" {
+		t.Fatalf("Incorrect error response %+v", response)
+	}
+	if method.Executor() == nil {
+		t.Fatal("Executor is not defined")
+	}
+}
+
+func TestReadOpenAPIModelFromFile(t *testing.T) {
+	model := new(Model)
+	if err := model.ReadModelFromFile("test-openapi-model.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	if model.Name() != "Test API" {
+		t.Fatalf("Unexpected model name %s", model.Name())
+	}
+	if model.BaseUrl() == nil || model.BaseUrl().Host != "api.github.com:3535" {
+		t.Fatal("Incorrect base URL")
+	}
+	if endpoint, ok := model.Endpoints()["/freemem/{format}"]; ok {
+		testPathParameters(endpoint, t)
+		testGetMethod(endpoint, t)
+	} else {
+		t.Fatal("Invalid number of endpoints")
+	}
+}
+
+func TestReadJSONModel(t *testing.T) {
+	const document = `{
+		"openapi": "3.0.0",
+		"info": {"title": "JSON API"},
+		"paths": {
+			"/echo/{message}": {
+				"get": {
+					"x-command-pattern": "echo {{.message}}",
+					"parameters": [{"name": "message", "in": "path", "schema": {"type": "string"}}]
+				}
+			}
+		}
+	}`
+	model := new(Model)
+	if err := model.ReadModel(strings.NewReader(document)); err != nil {
+		t.Fatal(err)
+	}
+	if endpoint, ok := model.Endpoints()["/echo/{message}"]; ok {
+		if response, ok := endpoint.GetMethodDescriptor(http.MethodGet).Response()[0]; !ok || response.StatusCode != 200 {
+			t.Fatal("Default response is not defined")
+		}
+	} else {
+		t.Fatal("Endpoint is not defined")
+	}
+}
+
+func TestCookieParameter(t *testing.T) {
+	const document = `
+openapi: 3.0.0
+paths:
+  /echo:
+    get:
+      x-command-pattern: echo {{.message}}
+      parameters:
+        - name: message
+          in: query
+          schema:
+            type: string
+        - name: session
+          in: cookie
+          schema:
+            type: string
+`
+	model := new(Model)
+	if err := model.ReadModel(strings.NewReader(document)); err != nil {
+		t.Fatal(err)
+	}
+	//cookie parameter is ignored
+	if parameters := model.Endpoints()["/echo"].GetMethodDescriptor(http.MethodGet).QueryParameters(); len(parameters) != 1 || parameters["message"] == nil {
+		t.Fatalf("Unexpected query parameters %v", parameters)
+	}
+}
+
+func TestResponseWithoutExitCode(t *testing.T) {
+	const document = `
+openapi: 3.0.0
+paths:
+  /echo:
+    get:
+      x-command-pattern: echo hello
+      responses:
+        '200':
+          x-exit-code: 0
+        '429':
+          description: Rate limit of reverse proxy
+`
+	model := new(Model)
+	if err := model.ReadModel(strings.NewReader(document)); err != nil {
+		t.Fatal(err)
+	}
+	//response which is not bound to exit code is skipped
+	if responses := model.Endpoints()["/echo"].GetMethodDescriptor(http.MethodGet).Response(); len(responses) != 1 || responses[0].StatusCode != 200 {
+		t.Fatalf("Unexpected responses %v", responses)
+	}
+}
+
+func TestOperationOptions(t *testing.T) {
+	const document = `
+openapi: 3.0.0
+paths:
+  /echo:
+    get:
+      x-command-pattern: echo
+      x-streaming: true
+      x-internal: true
+`
+	model := new(Model)
+	if err := model.ReadModel(strings.NewReader(document)); err != nil {
+		t.Fatal(err)
+	}
+	method := model.Endpoints()["/echo"].GetMethodDescriptor(http.MethodGet)
+	if !method.HasOption(rest.OptionStreaming) {
+		t.Fatal("Streaming is not enabled")
+	}
+	//unknown vendor extension is not an option
+	if method.HasOption("internal") {
+		t.Fatal("Unexpected option")
+	}
+}
+
+func TestMissingCommandPattern(t *testing.T) {
+	const document = `
+openapi: 3.0.0
+paths:
+  /echo:
+    get:
+      responses:
+        '200':
+          x-exit-code: 0
+`
+	if err := new(Model).ReadModel(strings.NewReader(document)); err == nil {
+		t.Fatal("Command pattern should be required")
+	}
+}
+
+func TestExport(t *testing.T) {
+	model := new(Model)
+	if err := model.ReadModelFromFile("test-openapi-model.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	//document is checked in the form received by consumers
+	var document map[string]interface{}
+	if content, err := json.Marshal(rest.ExportOpenAPI(model)); err != nil {
+		t.Fatal(err)
+	} else if err := json.Unmarshal(content, &document); err != nil {
+		t.Fatal(err)
+	}
+	if info := document["info"].(map[string]interface{}); info["title"] != model.Name() {
+		t.Fatalf("Unexpected info %v", info)
+	}
+	item, ok := document["paths"].(map[string]interface{})["/freemem/{format}"].(map[string]interface{})
+	if !ok {
+		t.Fatal("Endpoint is not exported")
+	} else if parameters := item["parameters"].([]interface{}); len(parameters) != 1 || parameters[0].(map[string]interface{})["name"] != "format" || parameters[0].(map[string]interface{})["required"] != true {
+		t.Fatalf("Unexpected path parameters %v", parameters)
+	}
+	operation := item["get"].(map[string]interface{})
+	//commands and exit codes are not exposed to consumers of the document
+	for _, name := range []string{fCommandPattern, fCommand, fPipeline, fEnvironment, fWorkingDirectory, fExitCode} {
+		if _, ok := operation[name]; ok {
+			t.Fatalf("Extension %s is exported", name)
+		}
+	}
+	parameters := make(map[string]map[string]interface{})
+	for _, parameter := range operation["parameters"].([]interface{}) {
+		parameter := parameter.(map[string]interface{})
+		parameters[parameter["in"].(string) + ":" + parameter["name"].(string)] = parameter["schema"].(map[string]interface{})
+	}
+	if schema := parameters["query:int"]; schema["type"] != "integer" || schema["default"] != 100.0 {
+		t.Fatalf("Query parameter is not exported: %v", parameters)
+	} else if schema := parameters["header:X-Dept"]; schema["type"] != "integer" {
+		t.Fatalf("Header is not exported: %v", parameters)
+	}
+	content := operation["requestBody"].(map[string]interface{})["content"].(map[string]interface{})
+	if schema := content["application/octet-stream"].(map[string]interface{})["schema"].(map[string]interface{}); schema["type"] != "string" || schema["format"] != "binary" {
+		t.Fatalf("Request body is not exported: %v", schema)
+	}
+	responses := operation["responses"].(map[string]interface{})
+	if len(responses) != 2 {
+		t.Fatalf("Unexpected responses %v", responses)
+	}
+	for statusCode, mimeType := range map[string]string{"200": "application/json", "404": "text/plain"} {
+		response := responses[statusCode].(map[string]interface{})
+		if _, ok := response[fExitCode]; ok {
+			t.Fatalf("Exit code of response %s is exported", statusCode)
+		} else if _, ok := response["content"].(map[string]interface{})[mimeType]; !ok {
+			t.Fatalf("Unexpected response %s: %v", statusCode, response)
+		}
+	}
+}
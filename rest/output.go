@@ -0,0 +1,49 @@
+package rest
+
+import (
+	"github.com/sakno/go2rest/cmdexec"
+	"os"
+	"errors"
+	"fmt"
+)
+
+//name of template parameter with location of the output produced by the process
+const TemplateParamOutput = "output"
+
+//produces response body after successful execution of the process
+type outputCollector func() (cmdexec.ExecutionResultRecorder, error)
+
+//allocates output file when response body is produced by the process instead of stdout.
+//Returns nil if stdout is used as response body
+func (self *requestContext) prepareOutput(successResponse ResponseDescriptor) (outputCollector, error) {
+	if successResponse.OutputDirectory {
+		return self.prepareOutputDirectory(successResponse)
+	} else if len(successResponse.OutputFile) == 0 {
+		return nil, nil
+	} else if file, err := cmdexec.NewTempFilePattern(successResponse.OutputFile); err == nil {
+		fileName := file.Name()
+		file.Close()
+		self.args[TemplateParamOutput] = fileName
+		self.Defer(func() { os.Remove(fileName) })	//file may remain if execution is failed
+		return func() (cmdexec.ExecutionResultRecorder, error) {
+			return cmdexec.NewFileRecorder(fileName, true)
+		}, nil
+	} else {
+		return nil, err
+	}
+}
+
+//allocates output directory which content is packed into archive after execution
+func (self *requestContext) prepareOutputDirectory(successResponse ResponseDescriptor) (outputCollector, error) {
+	if format, ok := GetArchiveFormatByMIME(successResponse.MimeType); !ok {
+		return nil, errors.New(fmt.Sprintf("Media type %s is not an archive", successResponse.MimeType))
+	} else if directory, err := cmdexec.NewTempDir(); err == nil {
+		self.args[TemplateParamOutput] = directory
+		self.Defer(func() { os.RemoveAll(directory) })
+		return func() (cmdexec.ExecutionResultRecorder, error) {
+			return cmdexec.NewArchiveRecorder(directory, format)
+		}, nil
+	} else {
+		return nil, err
+	}
+}
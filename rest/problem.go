@@ -0,0 +1,92 @@
+package rest
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"github.com/sakno/go2rest/cmdexec"
+)
+
+const (
+	headerAccept = "Accept"
+	mimeProblemJSON = "application/problem+json"
+	mimeJSON = "application/json"
+	//types of problems
+	problemGeneric = "about:blank"
+	problemInvalidParameter = "urn:go2rest:problem:invalid-parameter"
+	problemExecutionFailed = "urn:go2rest:problem:execution-failed"
+)
+
+//Describes error in the form of RFC 7807 problem details
+type problem struct {
+	Type string `json:"type"`
+	Title string `json:"title"`
+	Status int `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Parameter string `json:"parameter,omitempty"`	//name of invalid parameter
+	ExitCode *int `json:"exitCode,omitempty"`	//exit code of the process
+	Stage *int `json:"stage,omitempty"`	//index of the failed command in the pipeline
+}
+
+func newProblem(status int, detail string) *problem {
+	return &problem{Type: problemGeneric, Title: http.StatusText(status), Status: status, Detail: detail}
+}
+
+//creates problem caused by invalid parameter of the request
+func newParameterProblem(name string, status int, detail string) *problem {
+	result := newProblem(status, detail)
+	result.Type = problemInvalidParameter
+	result.Parameter = name
+	return result
+}
+
+//creates problem caused by failed execution of command-line tool
+func newExecutionProblem(err *cmdexec.ExecutionError, status int) *problem {
+	result := newProblem(status, err.Error())
+	result.Type = problemExecutionFailed
+	exitCode := err.ProcessExitCode
+	result.ExitCode = &exitCode
+	stage := err.Stage
+	result.Stage = &stage
+	return result
+}
+
+func (self *problem) Error() string {
+	return self.Detail
+}
+
+//indicates that client is able to parse problem details
+func acceptsProblem(request *http.Request) bool {
+	for _, mediaRange := range strings.Split(request.Header.Get(headerAccept), ",") {
+		if mediaType, params, err := mime.ParseMediaType(mediaRange); err != nil || params["q"] == "0" {
+			continue
+		} else if mediaType == mimeProblemJSON || mediaType == mimeJSON {
+			return true
+		}
+	}
+	return false
+}
+
+//writes error into HTTP response as problem details or plain text according with Accept header
+func writeError(err error, request *http.Request, response http.ResponseWriter) {
+	var details *problem
+	switch err := err.(type) {
+	case *problem:
+		details = err
+	default:
+		details = newProblem(http.StatusInternalServerError, err.Error())
+	}
+	if !acceptsProblem(request) {
+		http.Error(response, details.Detail, details.Status)
+	} else if content, err := json.Marshal(details); err == nil {
+		response.Header().Set(headerContentType, mimeProblemJSON)
+		response.Header().Set(headerContentLength, strconv.Itoa(len(content)))
+		response.Header().Set("X-Content-Type-Options", "nosniff")
+		response.WriteHeader(details.Status)
+		response.Write(content)
+	} else {
+		http.Error(response, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,173 @@
+package raml
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//Describes problem found in RAML model
+type ModelError struct {
+	File string	//file which contains the problem. Empty if model is read from stream
+	Line int	//line of the node with the problem. Zero if unknown
+	Column int
+	Path string	//path of the node inside of the model, e.g. /users/{id}/get/responses/200
+	Message string
+}
+
+func (self *ModelError) Error() string {
+	location := self.File
+	if self.Line > 0 && len(location) > 0 {
+		location = fmt.Sprintf("%s:%v:%v", location, self.Line, self.Column)
+	} else if self.Line > 0 { //model is read from stream
+		location = fmt.Sprintf("%v:%v", self.Line, self.Column)
+	}
+	message := self.Message
+	if len(self.Path) > 0 {
+		message = fmt.Sprintf("%s: %s", self.Path, message)
+	}
+	if len(location) > 0 {
+		return location + ": " + message
+	} else {
+		return message
+	}
+}
+
+//All problems found in RAML model ordered by their location
+type ModelErrors []*ModelError
+
+func (self ModelErrors) Error() string {
+	messages := make([]string, len(self))
+	for index, err := range self {
+		messages[index] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+//orders problems by their location
+func (self ModelErrors) sorted() ModelErrors {
+	sort.SliceStable(self, func(i, j int) bool {
+		switch {
+		case self[i].File != self[j].File:
+			return self[i].File < self[j].File
+		case self[i].Line != self[j].Line:
+			return self[i].Line < self[j].Line
+		default:
+			return self[i].Column < self[j].Column
+		}
+	})
+	return self
+}
+
+//location of YAML node
+type position struct {
+	file string
+	line int
+	column int
+}
+
+//Locations of YAML nodes by their path in the model
+type positionIndex map[string]position
+
+func pathKey(path []string) string {
+	return strings.Join(path, "\x00")
+}
+
+//returns location of the node or location of its nearest ancestor if the node is produced by resource type or trait
+func (self positionIndex) lookup(path []string) position {
+	for length := len(path); length >= 0; length-- {
+		if result, ok := self[pathKey(path[:length])]; ok {
+			return result
+		}
+	}
+	return position{}
+}
+
+//copies locations of the nodes to another path. Used for declarations imported from libraries
+func (self positionIndex) alias(from []string, to []string) {
+	prefix := pathKey(from)
+	for key, location := range self {
+		if key == prefix || strings.HasPrefix(key, prefix + "\x00") {
+			self[pathKey(to) + key[len(prefix):]] = location
+		}
+	}
+}
+
+func (self positionIndex) errorAt(path []string, message string) *ModelError {
+	location := self.lookup(path)
+	return &ModelError{File: location.file, Line: location.line, Column: location.column, Path: formatPath(path), Message: message}
+}
+
+//renders path of the node such as /users/{id}/get/queryParameters/page
+func formatPath(path []string) string {
+	result := ""
+	for _, key := range path {
+		if strings.HasPrefix(key, "/") {
+			result += key
+		} else {
+			result += "/" + key
+		}
+	}
+	return result
+}
+
+//State of RAML model parser associated with the node which is being parsed
+type parseContext struct {
+	path []string
+	types *typeRegistry
+	positions positionIndex
+	errors *ModelErrors
+	declared bool	//node belongs to user-defined type which problems are already reported with its declaration
+}
+
+//creates parser state. Problems found while loading the document are reported together with problems of the model
+func newParseContext(positions positionIndex, problems ModelErrors) *parseContext {
+	if positions == nil {
+		positions = make(positionIndex)
+	}
+	return &parseContext{positions: positions, errors: &problems}
+}
+
+//creates context of the nested node
+func (self *parseContext) child(keys ...interface{}) *parseContext {
+	path := make([]string, len(self.path), len(self.path) + len(keys))
+	copy(path, self.path)
+	for _, key := range keys {
+		path = append(path, fmt.Sprint(key))
+	}
+	result := *self
+	result.path = path
+	return &result
+}
+
+//creates context of the node which is parsed as a part of user-defined type
+func (self *parseContext) withinDeclaration() *parseContext {
+	result := *self
+	result.declared = true
+	return &result
+}
+
+//records problem of the node. Parsing continues so all problems are found in one pass
+func (self *parseContext) reportf(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if self.declared {
+		for _, err := range *self.errors {
+			if err.Message == message {
+				return
+			}
+		}
+	}
+	*self.errors = append(*self.errors, self.positions.errorAt(self.path, message))
+}
+
+func (self *parseContext) report(err error) {
+	self.reportf("%s", err.Error())
+}
+
+//returns all problems found by the parser
+func (self *parseContext) err() error {
+	if len(*self.errors) == 0 {
+		return nil
+	}
+	return self.errors.sorted()
+}
@@ -0,0 +1,543 @@
+package raml
+
+import (
+	"gopkg.in/yaml.v2"
+	yaml3 "gopkg.in/yaml.v3"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"regexp"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+const (
+	tagInclude = "!include"
+	fUses = "uses"
+	fExtends = "extends"
+	//kinds of RAML documents declared in the first line such as '#%RAML 1.0 Overlay'
+	documentOverlay = "Overlay"
+	documentExtension = "Extension"
+)
+
+//nodes of the document which can be changed by overlay in addition to annotations
+var documentationNodes = map[string]bool{"title": true, "description": true, "displayName": true, "documentation": true, "usage": true, "example": true, "examples": true, fExtends: true, fUses: true, "annotationTypes": true}
+
+//type names inside of type expression such as 'lib.Person[] | string'
+var typeNamePattern = regexp.MustCompile(`[^\s|()\[\]]+`)
+
+//syntax error reported by YAML parser such as 'yaml: line 3: mapping values are not allowed in this context'
+var syntaxErrorPattern = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+//Loads RAML document and all documents referenced by '!include' tags and 'uses' libraries.
+//Relative paths are resolved from the location of the document which contains the reference
+type documentLoader struct {
+	loading []string	//stack of documents which are being loaded, used to detect circular references
+	file string	//document which is being converted
+	positions positionIndex	//locations of the nodes used to report problems of the model
+	problems ModelErrors	//problems found in included files and libraries, loading continues after them
+}
+
+func newDocumentLoader() *documentLoader {
+	return &documentLoader{positions: make(positionIndex)}
+}
+
+//converts error of YAML parser into problem of the document
+func (self *documentLoader) syntaxError(err error) error {
+	if match := syntaxErrorPattern.FindStringSubmatch(err.Error()); match != nil {
+		line, _ := strconv.Atoi(match[1])
+		return &ModelError{File: self.file, Line: line, Column: 1, Message: match[2]}
+	} else {
+		return &ModelError{File: self.file, Message: err.Error()}
+	}
+}
+
+//records problem of the node found while loading
+func (self *documentLoader) reportAt(path []string, format string, args ...interface{}) {
+	self.problems = append(self.problems, self.positions.errorAt(path, fmt.Sprintf(format, args...)))
+}
+
+//returns fatal error which stops loading together with problems found before it
+func (self *documentLoader) failure(err error) error {
+	if len(self.problems) == 0 {
+		return err
+	} else if problem, ok := err.(*ModelError); ok {
+		return append(self.problems, problem).sorted()
+	} else {
+		return append(self.problems, &ModelError{File: self.file, Message: err.Error()}).sorted()
+	}
+}
+
+//indicates that included file should be parsed instead of being inserted as a string
+func isYAMLFile(fileName string) bool {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".raml", ".yaml", ".yml", ".json":
+		return true
+	default:
+		return false
+	}
+}
+
+//resolves path which is relative to the directory of the referring document
+func resolvePath(directory string, fileName string) string {
+	if filepath.IsAbs(fileName) {
+		return fileName
+	} else {
+		return filepath.Join(directory, fileName)
+	}
+}
+
+//loads document which root is placed at the path of the model
+func (self *documentLoader) load(fileName string, path []string) (interface{}, error) {
+	if absolute, err := filepath.Abs(fileName); err == nil {
+		fileName = absolute
+	} else {
+		return nil, err
+	}
+	for _, loading := range self.loading {
+		if loading == fileName {
+			return nil, errors.New(fmt.Sprintf("File %s includes itself", fileName))
+		}
+	}
+	if content, err := ioutil.ReadFile(fileName); err != nil {
+		return nil, err
+	} else if !isYAMLFile(fileName) {
+		//line break at the end of text file is not a part of included value such as command pattern
+		return strings.TrimRight(string(content), "\r\n"), nil
+	} else {
+		self.loading = append(self.loading, fileName)
+		file := self.file
+		self.file = fileName
+		defer func() {
+			self.loading = self.loading[:len(self.loading) - 1]
+			self.file = file
+		}()
+		return self.parse(content, filepath.Dir(fileName), path)
+	}
+}
+
+//parses YAML document and replaces '!include' tags with content of included files
+func (self *documentLoader) parse(content []byte, directory string, path []string) (interface{}, error) {
+	document := new(yaml3.Node)
+	if err := yaml3.Unmarshal(content, document); err != nil {
+		return nil, self.syntaxError(err)
+	} else if len(document.Content) == 0 { //empty document
+		return nil, nil
+	} else {
+		return self.convert(document.Content[0], directory, path), nil
+	}
+}
+
+//remembers location of the node. Location of the node which includes file is preserved
+func (self *documentLoader) locate(node *yaml3.Node, path []string) {
+	self.positions[pathKey(path)] = position{file: self.file, line: node.Line, column: node.Column}
+}
+
+func childPath(path []string, key interface{}) []string {
+	result := make([]string, len(path), len(path) + 1)
+	copy(result, path)
+	return append(result, fmt.Sprint(key))
+}
+
+//converts YAML node into representation used by the model parser.
+//yaml.v3 is used to read the document because only its nodes have line and column numbers,
+//but the model is represented as yaml.v2 MapSlice shared with templates, overlays and OpenAPI reader.
+//Problems of the node are recorded and the node is replaced with null so the rest of the document is still checked
+func (self *documentLoader) convert(node *yaml3.Node, directory string, path []string) interface{} {
+	switch node.Kind {
+	case yaml3.MappingNode:
+		result := make(yaml.MapSlice, 0, len(node.Content) / 2)
+		for index := 0; index + 1 < len(node.Content); index += 2 {
+			key := self.convert(node.Content[index], directory, path)
+			path := childPath(path, key)
+			self.locate(node.Content[index], path)
+			result = append(result, yaml.MapItem{Key: key, Value: self.convert(node.Content[index + 1], directory, path)})
+		}
+		return result
+	case yaml3.SequenceNode:
+		result := make([]interface{}, len(node.Content))
+		for index, item := range node.Content {
+			path := childPath(path, index)
+			self.locate(item, path)
+			result[index] = self.convert(item, directory, path)
+		}
+		return result
+	case yaml3.AliasNode:
+		return self.convert(node.Alias, directory, path)
+	case yaml3.ScalarNode:
+		if node.Tag == tagInclude {
+			if result, err := self.load(resolvePath(directory, node.Value), path); err == nil {
+				return result
+			} else if problem, ok := err.(*ModelError); ok { //syntax error inside of included document
+				self.problems = append(self.problems, problem)
+			} else {
+				self.problems = append(self.problems, &ModelError{File: self.file, Line: node.Line, Column: node.Column, Path: formatPath(path), Message: fmt.Sprintf("Failed to include %s. Error: %s", node.Value, err.Error())})
+			}
+			return nil
+		}
+		var result interface{}
+		if err := node.Decode(&result); err == nil {
+			return result
+		} else {
+			self.problems = append(self.problems, &ModelError{File: self.file, Line: node.Line, Column: node.Column, Path: formatPath(path), Message: err.Error()})
+			return nil
+		}
+	default:
+		self.problems = append(self.problems, &ModelError{File: self.file, Line: node.Line, Column: node.Column, Path: formatPath(path), Message: "Unexpected YAML node"})
+		return nil
+	}
+}
+
+//parses document which root is a map
+func (self *documentLoader) parseMap(content []byte, directory string) (yaml.MapSlice, error) {
+	if document, err := self.parse(content, directory, nil); err != nil {
+		return nil, err
+	} else if document, ok := document.(yaml.MapSlice); ok {
+		//problems without location are reported at the beginning of the main document
+		if _, ok := self.positions[pathKey(nil)]; !ok && len(self.file) > 0 {
+			self.positions[pathKey(nil)] = position{file: self.file, line: 1, column: 1}
+		}
+		return document, nil
+	} else {
+		return nil, &ModelError{File: self.file, Message: "RAML document should be a map"}
+	}
+}
+
+//returns kind of RAML document declared in its first line
+func documentKind(content []byte) string {
+	header := strings.SplitN(string(content), "\n", 2)[0]
+	if fields := strings.Fields(header); len(fields) > 2 && strings.HasPrefix(fields[0], "#%RAML") {
+		return fields[2]
+	} else {
+		return ""
+	}
+}
+
+//reads RAML document with its libraries. Overlay or extension is applied to the document referenced by 'extends'
+func (self *documentLoader) readModel(content []byte, directory string) (yaml.MapSlice, error) {
+	document, err := self.parseMap(content, directory)
+	if err != nil {
+		return nil, err
+	}
+	switch kind := documentKind(content); kind {
+	case documentOverlay, documentExtension:
+		if fileName, ok := mapSliceToMap(document)[fExtends].(string); !ok {
+			return nil, &ModelError{File: self.file, Message: fmt.Sprintf("%s should refer to extended document using 'extends'", kind)}
+		} else if base, err := self.readModelFile(resolvePath(directory, fileName)); err == nil {
+			return self.extend(base, document, kind, directory), nil
+		} else {
+			return nil, err
+		}
+	default:
+		return self.importLibraries(document, directory, nil), nil
+	}
+}
+
+func (self *documentLoader) readModelFile(fileName string) (yaml.MapSlice, error) {
+	name := fileName	//problems are reported using the name specified by the user
+	if absolute, err := filepath.Abs(fileName); err == nil {
+		fileName = absolute
+	} else {
+		return nil, err
+	}
+	for _, loading := range self.loading {
+		if loading == fileName {
+			return nil, errors.New(fmt.Sprintf("File %s extends itself", fileName))
+		}
+	}
+	if content, err := ioutil.ReadFile(fileName); err == nil {
+		self.loading = append(self.loading, fileName)
+		file := self.file
+		self.file = name
+		defer func() {
+			self.loading = self.loading[:len(self.loading) - 1]
+			self.file = file
+		}()
+		return self.readModel(content, filepath.Dir(fileName))
+	} else {
+		return nil, err
+	}
+}
+
+//applies overlay or extension file to the document. Document referenced by 'extends' is ignored
+func (self *documentLoader) readExtensionFile(base yaml.MapSlice, fileName string) (yaml.MapSlice, error) {
+	if content, err := ioutil.ReadFile(fileName); err != nil {
+		return nil, err
+	} else if kind := documentKind(content); kind != documentOverlay && kind != documentExtension {
+		return nil, errors.New(fmt.Sprintf("File %s is not an overlay or extension", fileName))
+	} else {
+		file := self.file
+		self.file = fileName
+		defer func() { self.file = file }()
+		if extension, err := self.parseMap(content, filepath.Dir(fileName)); err == nil {
+			return self.extend(base, extension, kind, filepath.Dir(fileName)), nil
+		} else {
+			return nil, err
+		}
+	}
+}
+
+//merges overlay or extension into the document. Overlay can change annotations and documentation only
+func (self *documentLoader) extend(base yaml.MapSlice, extension yaml.MapSlice, kind string, directory string) yaml.MapSlice {
+	if kind == documentOverlay {
+		self.validateOverlay(base, extension, nil)
+	}
+	extension = self.importLibraries(extension, directory, nil)
+	result := make(yaml.MapSlice, 0, len(extension))
+	for _, item := range extension {
+		if item.Key != fExtends {
+			result = append(result, item)
+		}
+	}
+	return mergeTrees(base, result).(yaml.MapSlice)
+}
+
+//reports all nodes which are added or changed by overlay
+func (self *documentLoader) validateOverlay(base interface{}, overlay interface{}, path []string) {
+	overlayTree, isMap := overlay.(yaml.MapSlice)
+	baseTree, isBaseMap := base.(yaml.MapSlice)
+	switch {
+	case isMap && isBaseMap:
+		declared := keyedMap(baseTree)
+		for _, item := range overlayTree {
+			name := fmt.Sprint(item.Key)
+			if strings.HasPrefix(name, "(") || documentationNodes[name] {
+				continue
+			} else if value, ok := declared[name]; ok {
+				self.validateOverlay(value, item.Value, childPath(path, name))
+			} else {
+				self.reportAt(childPath(path, name), "Overlay cannot add the node")
+			}
+		}
+	case isMap, isBaseMap, !reflect.DeepEqual(base, overlay):
+		self.reportAt(path, "Overlay cannot change the node")
+	}
+}
+
+//loads library and all libraries used by it
+func (self *documentLoader) loadLibrary(fileName string, path []string) (yaml.MapSlice, error) {
+	if library, err := self.load(fileName, path); err != nil {
+		return nil, err
+	} else if library, ok := library.(yaml.MapSlice); ok {
+		return self.importLibraries(library, filepath.Dir(fileName), path), nil
+	} else {
+		return nil, errors.New(fmt.Sprintf("Library %s is not a map of declarations", fileName))
+	}
+}
+
+//replaces 'uses' section of the document with declarations of the libraries.
+//Declarations of the library are available in the document with namespace prefix, e.g. 'lib.Person'.
+//Libraries which can't be loaded are reported and skipped
+func (self *documentLoader) importLibraries(document yaml.MapSlice, directory string, path []string) yaml.MapSlice {
+	uses, ok := mapSliceToMap(document)[fUses]
+	if !ok {
+		return document
+	}
+	libraries, ok := uses.(yaml.MapSlice)
+	if !ok {
+		self.reportAt(childPath(path, fUses), "Libraries should be declared as a map of namespaces")
+	}
+	sections := []string{fTypes, fResourceTypes, fTraits}
+	declarations := map[string]yaml.MapSlice{}
+	for _, library := range libraries {
+		namespace := fmt.Sprint(library.Key)
+		libraryPath := append(childPath(path, fUses), namespace)
+		if fileName, ok := library.Value.(string); !ok {
+			self.reportAt(libraryPath, "Path to library %s is expected", namespace)
+		} else if library, err := self.loadLibrary(resolvePath(directory, fileName), libraryPath); err == nil {
+			library := mapSliceToMap(library)
+			scope := newLibraryScope(library, namespace)
+			declarations[fTypes] = append(declarations[fTypes], qualifyTypes(library[fTypes], namespace)...)
+			declarations[fResourceTypes] = append(declarations[fResourceTypes], scope.qualifyTemplates(library[fResourceTypes])...)
+			declarations[fTraits] = append(declarations[fTraits], scope.qualifyTemplates(library[fTraits])...)
+			//problems of library declarations are reported at their location inside of the library
+			for _, section := range sections {
+				if items, ok := library[section].(yaml.MapSlice); ok {
+					for _, item := range items {
+						self.positions.alias(append(childPath(libraryPath, section), fmt.Sprint(item.Key)), append(childPath(path, section), namespace + "." + fmt.Sprint(item.Key)))
+					}
+				}
+			}
+		} else if problem, ok := err.(*ModelError); ok { //syntax error inside of the library
+			self.problems = append(self.problems, problem)
+		} else {
+			self.reportAt(libraryPath, "Failed to load library %s. Error: %s", namespace, err.Error())
+		}
+	}
+	//declarations of the document are placed after declarations of libraries
+	result := make(yaml.MapSlice, 0, len(document))
+	for _, item := range document {
+		switch item.Key {
+		case fUses:
+			continue
+		case fTypes, fResourceTypes, fTraits:
+			if own, ok := item.Value.(yaml.MapSlice); ok {
+				declarations[item.Key.(string)] = append(declarations[item.Key.(string)], own...)
+			}
+		default:
+			result = append(result, item)
+		}
+	}
+	for _, section := range sections {
+		if len(declarations[section]) > 0 {
+			result = append(result, yaml.MapItem{Key: section, Value: declarations[section]})
+		}
+	}
+	return result
+}
+
+//sections of method or resource type which contain declarations of parameters
+var parameterSections = map[string]bool{fQueryParameters: true, fHeaders: true, "uriParameters": true}
+
+//Declarations of the library which are referenced without namespace prefix inside of the library
+type libraryScope struct {
+	namespace string
+	types map[string]interface{}
+	resourceTypes map[string]interface{}
+	traits map[string]interface{}
+}
+
+func newLibraryScope(library map[string]interface{}, namespace string) *libraryScope {
+	result := &libraryScope{namespace: namespace, types: make(map[string]interface{}), resourceTypes: make(map[string]interface{}), traits: make(map[string]interface{})}
+	for section, local := range map[string]map[string]interface{}{fTypes: result.types, fResourceTypes: result.resourceTypes, fTraits: result.traits} {
+		if declarations, ok := library[section].(yaml.MapSlice); ok {
+			for _, declaration := range declarations {
+				local[fmt.Sprint(declaration.Key)] = declaration.Value
+			}
+		}
+	}
+	return result
+}
+
+//adds namespace prefix to names of library resource types or traits and to references to other declarations of the library
+func (self *libraryScope) qualifyTemplates(tree interface{}) yaml.MapSlice {
+	declarations, ok := tree.(yaml.MapSlice)
+	if !ok {
+		return nil
+	}
+	result := make(yaml.MapSlice, len(declarations))
+	for index, declaration := range declarations {
+		result[index] = yaml.MapItem{Key: self.namespace + "." + fmt.Sprint(declaration.Key), Value: self.qualifyTemplate(declaration.Value)}
+	}
+	return result
+}
+
+//qualifies reference to resource type or trait such as 'collection' or '{ collection: { item: User } }'
+func (self *libraryScope) qualifyReference(reference interface{}, local map[string]interface{}) interface{} {
+	switch reference := reference.(type) {
+	case string:
+		if _, ok := local[reference]; ok {
+			return self.namespace + "." + reference
+		}
+	case yaml.MapSlice:
+		if len(reference) == 1 {
+			if _, ok := local[fmt.Sprint(reference[0].Key)]; ok {
+				return yaml.MapSlice{yaml.MapItem{Key: self.namespace + "." + fmt.Sprint(reference[0].Key), Value: reference[0].Value}}
+			}
+		}
+	}
+	return reference
+}
+
+//qualifies references inside of resource type or trait: base resource type, applied traits and types of parameters and bodies
+func (self *libraryScope) qualifyTemplate(tree interface{}) interface{} {
+	node, ok := tree.(yaml.MapSlice)
+	if !ok {
+		return tree
+	}
+	result := make(yaml.MapSlice, len(node))
+	for index, item := range node {
+		switch key := fmt.Sprint(item.Key); {
+		case key == fType:
+			item.Value = self.qualifyReference(item.Value, self.resourceTypes)
+		case key == fIs:
+			traits := toList(item.Value)
+			qualified := make([]interface{}, len(traits))
+			for index, trait := range traits {
+				qualified[index] = self.qualifyReference(trait, self.traits)
+			}
+			item.Value = qualified
+		case parameterSections[key]:
+			if parameters, ok := item.Value.(yaml.MapSlice); ok {
+				qualified := make(yaml.MapSlice, len(parameters))
+				for index, parameter := range parameters {
+					qualified[index] = yaml.MapItem{Key: parameter.Key, Value: qualifyDeclaration(parameter.Value, self.namespace, self.types)}
+				}
+				item.Value = qualified
+			}
+		case key == fBody:
+			item.Value = self.qualifyBody(item.Value)
+		default: //methods, responses and their status codes
+			item.Value = self.qualifyTemplate(item.Value)
+		}
+		result[index] = item
+	}
+	return result
+}
+
+//body is declared as a map of media types or as a type of the default media type
+func (self *libraryScope) qualifyBody(body interface{}) interface{} {
+	if mediaTypes, ok := body.(yaml.MapSlice); ok && len(mediaTypes) > 0 && strings.Contains(fmt.Sprint(mediaTypes[0].Key), "/") {
+		result := make(yaml.MapSlice, len(mediaTypes))
+		for index, mediaType := range mediaTypes {
+			result[index] = yaml.MapItem{Key: mediaType.Key, Value: qualifyDeclaration(mediaType.Value, self.namespace, self.types)}
+		}
+		return result
+	}
+	return qualifyDeclaration(body, self.namespace, self.types)
+}
+
+//adds namespace prefix to declarations of library types and references between them
+func qualifyTypes(tree interface{}, namespace string) yaml.MapSlice {
+	declarations, ok := tree.(yaml.MapSlice)
+	if !ok {
+		return nil
+	}
+	local := mapSliceToMap(declarations)
+	result := make(yaml.MapSlice, len(declarations))
+	for index, declaration := range declarations {
+		result[index] = yaml.MapItem{Key: namespace + "." + fmt.Sprint(declaration.Key), Value: qualifyDeclaration(declaration.Value, namespace, local)}
+	}
+	return result
+}
+
+func qualifyDeclaration(declaration interface{}, namespace string, local map[string]interface{}) interface{} {
+	switch declaration := declaration.(type) {
+	case string:
+		return typeNamePattern.ReplaceAllStringFunc(declaration, func(name string) string {
+			if _, ok := local[name]; ok {
+				return namespace + "." + name
+			} else {
+				return name
+			}
+		})
+	case []interface{}: //multiple inheritance
+		result := make([]interface{}, len(declaration))
+		for index, base := range declaration {
+			result[index] = qualifyDeclaration(base, namespace, local)
+		}
+		return result
+	case yaml.MapSlice:
+		result := make(yaml.MapSlice, len(declaration))
+		for index, facet := range declaration {
+			switch facet.Key {
+			case fType, fItems:
+				facet.Value = qualifyDeclaration(facet.Value, namespace, local)
+			case fProperties:
+				if properties, ok := facet.Value.(yaml.MapSlice); ok {
+					qualified := make(yaml.MapSlice, len(properties))
+					for index, property := range properties {
+						qualified[index] = yaml.MapItem{Key: property.Key, Value: qualifyDeclaration(property.Value, namespace, local)}
+					}
+					facet.Value = qualified
+				}
+			}
+			result[index] = facet
+		}
+		return result
+	default:
+		return declaration
+	}
+}
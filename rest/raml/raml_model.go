@@ -20,6 +20,7 @@ import (
 	"github.com/sakno/go2rest/rest"
 	"net/http"
 	"net/url"
+	"time"
 )
 
 const (
@@ -31,6 +32,7 @@ const (
 	tFile    = "file"
 	tArray   = "array"
 	tAny     = "any"
+	tObject  = "object"
 	//RAML fields
 	fType      = "type"
 	fRequired  = "required"
@@ -43,6 +45,9 @@ const (
 	fMinItems  = "minItems"
 	fMaxItems  = "maxItems"
 	fItems     = "items"
+	fProperties = "properties"
+	fAdditionalProperties = "additionalProperties"
+	fTypes     = "types"
 	fHeaders   = "headers"
 	fBaseUri = "baseUri"
 	fTitle = "title"
@@ -51,8 +56,21 @@ const (
 	fResponses = "responses"
 	fExitCode  = "(exitCode)"
 	fCommandPattern = "(commandPattern)"
+	fCommand = "(command)"
+	fPipeline = "(pipeline)"
+	fEnvironment = "(environment)"
+	fInheritEnvironment = "(inheritEnvironment)"
+	fWorkingDirectory = "(workingDirectory)"
+	fOutputFile = "(outputFile)"
+	fTimeout = "(timeout)"
+	//boolean annotations
+	optionErrorDetails = "errorDetails"
+	optionOutputDirectory = "outputDirectory"
 )
 
+//annotations which describe command-line tool
+var commandFields = rest.CommandFields{Command: fCommand, CommandPattern: fCommandPattern, Pipeline: fPipeline, Environment: fEnvironment, InheritEnvironment: fInheritEnvironment, WorkingDirectory: fWorkingDirectory}
+
 func mapSliceToMap(tree yaml.MapSlice) map[string]interface{} {
 	//convert parameter fields into map
 	fields := make(map[string]interface{}, len(tree))
@@ -129,14 +147,14 @@ func (self *AnyParameter) ReadValue(value io.Reader, format rest.ParameterValueF
 	}
 }
 
-func (self *AnyParameter) parse(description map[string]interface{}) {
+func (self *AnyParameter) parse(description map[string]interface{}, ctx *parseContext) {
 	self.Parameter = parseBaseParameter(description)
 
 }
 
 func (self *AnyParameter) Validate(value interface{}) bool {
 	switch value.(type) {
-	case bytes.Buffer, os.File, string, float64, bool, nil:
+	case bytes.Buffer, os.File, string, float64, bool, nil, map[string]interface{}, []interface{}:
 		return true
 	default:
 		return false
@@ -162,7 +180,7 @@ func (self *FileParameter) ReadValue(value io.Reader, format rest.ParameterValue
 	}
 }
 
-func (self *FileParameter) parse(description map[string]interface{}){
+func (self *FileParameter) parse(description map[string]interface{}, ctx *parseContext){
 	self.Parameter = parseBaseParameter(description)
 	self.hasDefaultValue = false
 }
@@ -252,7 +270,7 @@ func (self *NumberParameter) init(){
 	self.minimum = math.SmallestNonzeroFloat64
 }
 
-func (self *NumberParameter) parse(description map[string]interface{}){
+func (self *NumberParameter) parse(description map[string]interface{}, ctx *parseContext){
 	self.init()
 	self.Parameter = parseBaseParameter(description)
 
@@ -261,16 +279,24 @@ func (self *NumberParameter) parse(description map[string]interface{}){
 		if defaultValue, err := toFloat64(description[fDefault]); err == nil {
 			self.defaultValue = defaultValue
 		} else {
-			log.Fatal(err.Error())
+			ctx.child(fDefault).report(err)
 		}
 	}
 	//parse minimum
-	if minimum, err := toFloat64(description[fMinimum]); err == nil {
-		self.minimum = minimum
+	if minimum, ok := description[fMinimum]; ok {
+		if minimum, err := toFloat64(minimum); err == nil {
+			self.minimum = minimum
+		} else {
+			ctx.child(fMinimum).report(err)
+		}
 	}
 	//parse maximum
-	if maximum, err := toFloat64(description[fMaximum]); err == nil {
-		self.maximum = maximum
+	if maximum, ok := description[fMaximum]; ok {
+		if maximum, err := toFloat64(maximum); err == nil {
+			self.maximum = maximum
+		} else {
+			ctx.child(fMaximum).report(err)
+		}
 	}
 }
 
@@ -402,7 +428,7 @@ func (self *IntegerParameter) init() {
 	self.minimum = math.MinInt64
 }
 
-func (self *IntegerParameter) parse(description map[string]interface{}) {
+func (self *IntegerParameter) parse(description map[string]interface{}, ctx *parseContext) {
 	self.init()
 	self.Parameter = parseBaseParameter(description)
 
@@ -411,16 +437,24 @@ func (self *IntegerParameter) parse(description map[string]interface{}) {
 		if defaultValue, err := toInt64(description[fDefault]); err == nil {
 			self.defaultValue = defaultValue
 		} else {
-			log.Fatal(err.Error())
+			ctx.child(fDefault).report(err)
 		}
 	}
 	//parse minimum
-	if minimum, err := toInt64(description[fMinimum]); err == nil {
-		self.minimum = minimum
+	if minimum, ok := description[fMinimum]; ok {
+		if minimum, err := toInt64(minimum); err == nil {
+			self.minimum = minimum
+		} else {
+			ctx.child(fMinimum).report(err)
+		}
 	}
 	//parse maximum
-	if maximum, err := toInt64(description[fMaximum]); err == nil {
-		self.maximum = maximum
+	if maximum, ok := description[fMaximum]; ok {
+		if maximum, err := toInt64(maximum); err == nil {
+			self.maximum = maximum
+		} else {
+			ctx.child(fMaximum).report(err)
+		}
 	}
 }
 
@@ -448,8 +482,8 @@ func (self *IntegerParameter) Validate(value interface{}) bool {
 		return self.validate(int64(typed))
 	case int:
 		return self.validate(int64(typed))
-	case float64:
-		return self.validate(int64(typed))
+	case float64: //JSON number should not have fractional part
+		return typed == math.Trunc(typed) && self.validate(int64(typed))
 	default:
 		return false
 	}
@@ -492,7 +526,7 @@ func (self *BooleanParameter) ReadValue(value io.Reader, format rest.ParameterVa
 	}
 }
 
-func (self *BooleanParameter) parse(description map[string]interface{}) {
+func (self *BooleanParameter) parse(description map[string]interface{}, ctx *parseContext) {
 	self.Parameter = parseBaseParameter(description)
 	//parse default value
 	if self.hasDefaultValue {
@@ -503,10 +537,10 @@ func (self *BooleanParameter) parse(description map[string]interface{}) {
 			if defaultValue, err := strconv.ParseBool(defaultValue); err == nil {
 				self.defaultValue = defaultValue
 			} else {
-				log.Fatalf("Failed to parse boolean constant: %s", err.Error())
+				ctx.child(fDefault).reportf("Failed to parse boolean constant: %s", err.Error())
 			}
 		default:
-			log.Fatalf("Failed to parse boolean constant: %v", defaultValue)
+			ctx.child(fDefault).reportf("Failed to parse boolean constant: %v", defaultValue)
 		}
 	}
 }
@@ -557,18 +591,29 @@ func (self *StringParameter) init() {
 	self.pattern = nil
 }
 
-func (self *StringParameter) parse(description map[string]interface{}) {
+func (self *StringParameter) parse(description map[string]interface{}, ctx *parseContext) {
 	//defaults
 	self.init()
 
 	self.Parameter = parseBaseParameter(description)
 	//parse default value
 	if self.hasDefaultValue {
-		self.defaultValue = description[fDefault].(string)
+		switch defaultValue := description[fDefault].(type) {
+		case string:
+			self.defaultValue = defaultValue
+		case int, float64, bool:
+			self.defaultValue = fmt.Sprint(defaultValue)
+		default:
+			ctx.child(fDefault).reportf("Failed to parse string constant: %v", defaultValue)
+		}
 	}
 	//parse pattern
 	if pattern, ok := description[fPattern].(string); ok {
-		self.pattern = regexp.MustCompile(pattern)
+		if pattern, err := regexp.Compile(pattern); err == nil {
+			self.pattern = pattern
+		} else {
+			ctx.child(fPattern).reportf("Invalid pattern. Error: %s", err.Error())
+		}
 	} else {
 		self.pattern = nil
 	}
@@ -577,7 +622,7 @@ func (self *StringParameter) parse(description map[string]interface{}) {
 		if minLength, err := toUInt32(minLength); err == nil {
 			self.minLength = minLength
 		} else {
-			log.Fatal(err.Error())
+			ctx.child(fMinLength).report(err)
 		}
 	}
 	//parse max length
@@ -585,7 +630,7 @@ func (self *StringParameter) parse(description map[string]interface{}) {
 		if maxLength, err := toUInt32(maxLength); err == nil {
 			self.maxLength = maxLength
 		} else {
-			log.Fatal(err.Error())
+			ctx.child(fMaxLength).report(err)
 		}
 	}
 }
@@ -647,29 +692,37 @@ func (self *ArrayParameter) init(){
 	self.maxItems = math.MaxInt32
 }
 
-func (self *ArrayParameter) parse(description map[string]interface{}) {
+func (self *ArrayParameter) parse(description map[string]interface{}, ctx *parseContext) {
 	self.init()
 	self.Parameter = parseBaseParameter(description)
 	self.hasDefaultValue = false
 	//parse min items
-	if minItems, err := toUInt32(description[fMinItems]); err == nil {
-		self.minItems = minItems
+	if minItems, ok := description[fMinItems]; ok {
+		if minItems, err := toUInt32(minItems); err == nil {
+			self.minItems = minItems
+		} else {
+			ctx.child(fMinItems).report(err)
+		}
 	}
 	//parse max items
-	if maxItems, err := toUInt32(description[fMaxItems]); err == nil {
-		self.maxItems = maxItems
+	if maxItems, ok := description[fMaxItems]; ok {
+		if maxItems, err := toUInt32(maxItems); err == nil {
+			self.maxItems = maxItems
+		} else {
+			ctx.child(fMaxItems).report(err)
+		}
 	}
 	//parse element type
 	switch items := description[fItems].(type) {
 	case string: //items contains name of type
-		self.elementType = parseParameterType(items, make(map[string]interface{}, 0))
+		self.elementType = parseParameterType(items, make(map[string]interface{}, 0), ctx.child(fItems))
 	case yaml.MapSlice:
-		self.elementType = parseParameter(items)
+		self.elementType = parseParameter(items, ctx.child(fItems))
 	case rest.Parameter:
 		self.elementType = items
 	default:
 		if self.elementType == nil {
-			log.Fatalf("Unsupported array type %+v", items)
+			ctx.child(fItems).reportf("Unsupported array type %+v", items)
 		}
 	}
 }
@@ -683,7 +736,7 @@ func (self *ArrayParameter) Validate(value interface{}) bool {
 	case reflect.Slice:
 		//validate each element of array
 		length := reflectedValue.Len()
-		if uint32(length) <= self.minItems || uint32(length) >= self.maxItems {
+		if uint32(length) < self.minItems || uint32(length) > self.maxItems {
 			return false
 		}
 		for i := 0; i < length; i++ {
@@ -704,89 +757,390 @@ func (self *ArrayParameter) ElementType() rest.Parameter {
 	return self.elementType
 }
 
+//Represents parameter of type 'object' restored from RAML model
+type ObjectParameter struct {
+	Parameter
+	properties rest.ParameterList
+	additionalProperties bool
+}
+
+func (self *ObjectParameter) ReadValue(value io.Reader, format rest.ParameterValueFormat) (interface{}, error) {
+	switch format {
+	case rest.FormatJSON, rest.FormatText:
+		result := make(map[string]interface{})
+		err := json.NewDecoder(value).Decode(&result)
+		return result, err
+	default:
+		return nil, new(rest.UnsupportedParameterValueFormat)
+	}
+}
+
+func (self *ObjectParameter) parse(description map[string]interface{}, ctx *parseContext) {
+	self.Parameter = parseBaseParameter(description)
+	self.hasDefaultValue = false
+	self.properties = make(rest.ParameterList)
+	if properties, ok := description[fProperties].(yaml.MapSlice); ok {
+		for _, item := range properties {
+			if name, ok := item.Key.(string); ok {
+				log.Printf("Start parsing property %s", name)
+				//property with '?' suffix is optional
+				if strings.HasSuffix(name, "?") {
+					name = strings.TrimSuffix(name, "?")
+					self.properties[name] = parseParameter(optional(item.Value), ctx.child(fProperties, item.Key))
+				} else {
+					self.properties[name] = parseParameter(item.Value, ctx.child(fProperties, item.Key))
+				}
+			}
+		}
+	} else if properties, ok := description[fProperties]; ok {
+		ctx.child(fProperties).reportf("Unexpected tree type inside of properties: %+v", properties)
+	}
+	//additional properties are allowed by default
+	switch description[fAdditionalProperties] {
+	case false, "false":
+		self.additionalProperties = false
+	default:
+		self.additionalProperties = true
+	}
+}
+
+//marks declaration of the property as optional if it is not specified explicitly
+func optional(description interface{}) interface{} {
+	switch description := description.(type) {
+	case string:
+		return yaml.MapSlice{{Key: fType, Value: description}, {Key: fRequired, Value: false}}
+	case yaml.MapSlice:
+		if _, ok := mapSliceToMap(description)[fRequired]; ok {
+			return description
+		}
+		return append(append(yaml.MapSlice{}, description...), yaml.MapItem{Key: fRequired, Value: false})
+	default:
+		return description
+	}
+}
+
+func (self *ObjectParameter) Validate(value interface{}) bool {
+	if value, ok := value.(map[string]interface{}); ok {
+		for name, property := range self.properties {
+			if value, exists := value[name]; !exists {
+				if property.Required() && !property.HasDefaultValue() {
+					return false
+				}
+			} else if !property.Validate(value) {
+				return false
+			}
+		}
+		if !self.additionalProperties {
+			for name := range value {
+				if _, declared := self.properties[name]; !declared {
+					return false
+				}
+			}
+		}
+		return true
+	} else {
+		return false
+	}
+}
+
+func (self *ObjectParameter) AdditionalProperties() bool {
+	return self.additionalProperties
+}
+
+func (self *ObjectParameter) Fields() rest.ParameterList {
+	return self.properties
+}
+
+//Represents union of types such as 'string | integer' restored from RAML model
+type UnionParameter struct {
+	Parameter
+	members []rest.Parameter
+}
+
+//splits type expression into members of union. Parentheses are respected
+func splitUnion(expression string) []string {
+	members := make([]string, 0)
+	depth, start := 0, 0
+	for index, char := range expression {
+		switch char {
+		case '(':
+			depth += 1
+		case ')':
+			depth -= 1
+		case '|':
+			if depth == 0 {
+				members = append(members, strings.TrimSpace(expression[start:index]))
+				start = index + 1
+			}
+		}
+	}
+	return append(members, strings.TrimSpace(expression[start:]))
+}
+
+func (self *UnionParameter) parse(description map[string]interface{}, members []string, ctx *parseContext) {
+	self.Parameter = parseBaseParameter(description)
+	self.hasDefaultValue = false
+	self.members = make([]rest.Parameter, len(members))
+	for index, member := range members {
+		self.members[index] = parseParameterType(member, make(map[string]interface{}), ctx)
+	}
+}
+
+//value is restored using the first member of union which accepts it
+func (self *UnionParameter) ReadValue(value io.Reader, format rest.ParameterValueFormat) (interface{}, error) {
+	if content, err := ioutil.ReadAll(value); err == nil {
+		for _, member := range self.members {
+			if value, err := member.ReadValue(bytes.NewReader(content), format); err == nil && member.Validate(value) {
+				return value, nil
+			}
+		}
+		return nil, errors.New("Value doesn't match to any type of union")
+	} else {
+		return nil, err
+	}
+}
+
+func (self *UnionParameter) Validate(value interface{}) bool {
+	for _, member := range self.members {
+		if member.Validate(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (self *UnionParameter) Members() []rest.Parameter {
+	return self.members
+}
+
+//User-defined types declared in 'types' section of RAML model
+type typeRegistry struct {
+	declarations map[string]interface{}
+	resolving map[string]bool	//types which are being parsed, used to detect recursive declarations
+}
+
+func newTypeRegistry(declarations interface{}, ctx *parseContext) *typeRegistry {
+	result := &typeRegistry{declarations: make(map[string]interface{}), resolving: make(map[string]bool)}
+	if declarations, ok := declarations.(yaml.MapSlice); ok {
+		for _, item := range declarations {
+			if name, ok := item.Key.(string); ok {
+				log.Printf("Declaring type %s", name)
+				result.declarations[name] = item.Value
+			}
+		}
+	} else {
+		ctx.reportf("Unexpected tree type inside of types: %+v", declarations)
+	}
+	return result
+}
+
+func (self *typeRegistry) declares(name string) bool {
+	if self == nil {
+		return false
+	} else {
+		_, ok := self.declarations[name]
+		return ok
+	}
+}
+
+//returns facets of user-defined type including facets of its base types
+func (self *typeRegistry) facets(name string, ctx *parseContext) map[string]interface{} {
+	if self.resolving[name] {
+		ctx.reportf("Type %s is declared recursively", name)
+		return map[string]interface{}{fType: tAny}
+	}
+	self.resolving[name] = true
+	defer delete(self.resolving, name)
+	switch declaration := self.declarations[name].(type) {
+	case string: //declaration contains type expression only
+		return self.inherit(declaration, make(map[string]interface{}), ctx)
+	case yaml.MapSlice:
+		fields := mapSliceToMap(declaration)
+		if parameterType, ok := fields[fType]; ok {
+			return self.inherit(parameterType, fields, ctx)
+		} else {
+			return fields
+		}
+	default:
+		ctx.reportf("Declaration of type %s is invalid: %+v", name, declaration)
+		return map[string]interface{}{fType: tAny}
+	}
+}
+
+//merges facets of base types with facets of the declaration.
+//Facets of the declaration override inherited facets, properties of objects are combined
+func (self *typeRegistry) inherit(parameterType interface{}, fields map[string]interface{}, ctx *parseContext) map[string]interface{} {
+	bases, ok := parameterType.([]interface{})
+	if !ok {
+		bases = []interface{}{parameterType}
+	}
+	result := make(map[string]interface{})
+	for _, base := range bases {
+		if name, ok := base.(string); ok && self.declares(name) {
+			mergeFacets(result, self.facets(name, ctx))
+		} else {
+			mergeFacets(result, map[string]interface{}{fType: base})
+		}
+	}
+	//type of the declaration is replaced with the inherited one
+	own := make(map[string]interface{}, len(fields))
+	for name, value := range fields {
+		if name != fType {
+			own[name] = value
+		}
+	}
+	mergeFacets(result, own)
+	return result
+}
+
+func mergeFacets(target map[string]interface{}, source map[string]interface{}) {
+	for name, value := range source {
+		inherited, isMap := target[name].(yaml.MapSlice)
+		if properties, ok := value.(yaml.MapSlice); ok && isMap && name == fProperties {
+			target[name] = mergeProperties(inherited, properties)
+		} else {
+			target[name] = value
+		}
+	}
+}
+
+func mergeProperties(inherited yaml.MapSlice, properties yaml.MapSlice) yaml.MapSlice {
+	overridden := mapSliceToMap(properties)
+	result := make(yaml.MapSlice, 0, len(inherited) + len(properties))
+	for _, property := range inherited {
+		if name, ok := property.Key.(string); ok {
+			if _, ok := overridden[name]; ok {
+				continue
+			} else if _, ok := overridden[strings.TrimSuffix(name, "?")]; ok {
+				continue
+			} else if _, ok := overridden[name + "?"]; ok {
+				continue
+			}
+		}
+		result = append(result, property)
+	}
+	return append(result, properties...)
+}
+
 type MethodDescriptor struct {
 	queryParameters rest.ParameterList
 	reqHeaders rest.ParameterList
 	request rest.ParameterList
 	responses map[int]rest.ResponseDescriptor
 	executor cmdexec.CommandExecutor
+	options map[string]bool
 }
 
 func (self *MethodDescriptor) HasOption(name string) bool {
-	return false
+	return self.options[name]
+}
+
+//extracts boolean annotations such as '(streaming): true'
+func parseOptions(tree map[string]interface{}) map[string]bool {
+	options := make(map[string]bool)
+	for name, value := range tree {
+		if strings.HasPrefix(name, "(") && strings.HasSuffix(name, ")") {
+			switch value {
+			case true, "true":
+				options[name[1:len(name) - 1]] = true
+			}
+		}
+	}
+	return options
 }
 
 func (self *MethodDescriptor) Executor() cmdexec.CommandExecutor {
 	return self.executor
 }
 
-func (self *MethodDescriptor) parse(description interface{}) {
+func (self *MethodDescriptor) parse(description interface{}, defaultTimeout time.Duration, ctx *parseContext) {
+	self.reqHeaders = make(rest.ParameterList)
+	self.queryParameters = make(rest.ParameterList)
+	self.request = make(rest.ParameterList)
+	self.responses = make(map[int]rest.ResponseDescriptor)
 	if tree, ok := description.(yaml.MapSlice); ok {
 		tree := mapSliceToMap(tree)
+		self.options = parseOptions(tree)
 		//parse headers
-		self.reqHeaders = make(rest.ParameterList)
 		if reqHeaders, ok := tree[fHeaders]; ok {
-			parseParameterList(reqHeaders, self.reqHeaders)
+			parseParameterList(reqHeaders, self.reqHeaders, ctx.child(fHeaders))
 		}
 		//parse query parameters
-		self.queryParameters = make(rest.ParameterList)
 		if queryParameters, ok := tree[fQueryParameters]; ok {
-			parseParameterList(queryParameters, self.queryParameters)
+			parseParameterList(queryParameters, self.queryParameters, ctx.child(fQueryParameters))
 		}
 		//parse body
-		self.request = make(rest.ParameterList)
 		if request, ok := tree[fBody]; ok {
-			parseParameterList(request, self.request)
-		}
-		//parse command pattern
-		if commandPattern, ok := tree[fCommandPattern]; ok {
-			if commandPattern, ok := commandPattern.(string); ok {
-				if renderer, err := cmdexec.NewAutoNamedRenderer(commandPattern); err == nil {
-					self.executor = cmdexec.NewCommandExecutor(renderer)
-				} else {
-					log.Fatalf("Failed to parse command pattern %s. Error %s", commandPattern, err.Error())
+			parseParameterList(request, self.request, ctx.child(fBody))
+			for mimeType, body := range self.request {
+				if err := rest.ValidateRequestBody(mimeType, body); err != nil {
+					ctx.child(fBody, mimeType).report(err)
 				}
+			}
+		}
+		//parse timeout
+		timeout := defaultTimeout
+		if value, ok := tree[fTimeout]; ok {
+			if value, err := rest.ParseTimeout(value); err == nil {
+				timeout = value
 			} else {
-				log.Fatal("Invalid format of command pattern")
+				ctx.child(fTimeout).report(err)
 			}
+		}
+		//parse command pattern
+		if pipeline, err := commandFields.ParsePipeline(tree); err != nil {
+			ctx.report(err)
+		} else if err := commandFields.ParseEnvironment(tree, pipeline); err != nil {
+			ctx.report(err)
+		} else if err := commandFields.ParseWorkingDirectory(tree, pipeline, self.options); err != nil {
+			ctx.report(err)
 		} else {
-			log.Fatal("Command pattern is not specified")
+			self.executor = cmdexec.NewPipelineExecutor(pipeline, timeout)
 		}
 		//parse responses
-		self.responses = make(map[int]rest.ResponseDescriptor)
 		if responses, ok := tree[fResponses]; ok {//move to 'responses'
 			if responses, ok := responses.(yaml.MapSlice); ok {
 				for _, response := range responses {	//each response is STATUS CODE: RESPONSE
+					ctx := ctx.child(fResponses, response.Key)
 					if statusCode, ok := response.Key.(int); ok {	//parse status code
 						if response, ok := response.Value.(yaml.MapSlice); ok {	//parse response
 							response := mapSliceToMap(response)
 							//extract exit code
 							if exitCode, ok := response[fExitCode]; ok {
-								if exitCode, ok := exitCode.(int); ok {
+								if exitCode, ok := rest.ParseExitCode(exitCode); ok {
 									if body, ok := response[fBody]; ok {
 										responses := make(rest.ParameterList)
-										parseParameterList(body, responses)
+										parseParameterList(body, responses, ctx.child(fBody))
+										options := parseOptions(response)
+										outputFile, ok := rest.ParseOutputFile(response[fOutputFile])
+										if !ok {
+											ctx.child(fOutputFile).reportf("Output file for status code %v has invalid value", statusCode)
+										}
 										for mimeType, body := range responses {
-											self.responses[exitCode] = rest.ResponseDescriptor{StatusCode: statusCode, Body: body, MimeType: mimeType}
+											descriptor := rest.ResponseDescriptor{StatusCode: statusCode, Body: body, MimeType: mimeType, ErrorDetails: options[optionErrorDetails], OutputFile: outputFile, OutputDirectory: options[optionOutputDirectory]}
+											if err := rest.ValidateOutput(descriptor); err != nil {
+												ctx.child(fBody, mimeType).report(err)
+											}
+											self.responses[exitCode] = descriptor
 										}
 									} else {
-										log.Fatalf("Response body is not specified for status code %v", statusCode)
+										ctx.reportf("Response body is not specified for status code %v", statusCode)
 									}
 								} else {
-									log.Fatalf("Exit code for status code %s has invalid value", statusCode)
+									ctx.child(fExitCode).reportf("Exit code for status code %v has invalid value", statusCode)
 								}
 							} else {
-								log.Fatalf("Exit code for status code %s is not specified", statusCode)
+								ctx.reportf("Exit code for status code %v is not specified", statusCode)
 							}
 						} else {
-							log.Fatalf("Description of body for status code %s is invalid", statusCode)
+							ctx.reportf("Description of body for status code %v is invalid", statusCode)
 						}
 					} else {
-						log.Fatalf("Incorrect HTTP status code: %v", response.Key)
+						ctx.reportf("Incorrect HTTP status code: %v", response.Key)
 					}
 				}
 			} else {
-				log.Fatalf("Description of endpoint responses is not valid: %+v", responses)
+				ctx.child(fResponses).reportf("Description of endpoint responses is not valid: %+v", responses)
 			}
 		} else {
 			parameter := new(StringParameter)
@@ -794,7 +1148,7 @@ func (self *MethodDescriptor) parse(description interface{}) {
 			self.responses[0] = rest.ResponseDescriptor{StatusCode: 200, MimeType: "text/plain", Body: parameter}
 		}
 	} else {
-		log.Fatalf("Unrecognized description of HTTP method: %+v", description)
+		ctx.reportf("Unrecognized description of HTTP method: %+v", description)
 	}
 }
 
@@ -824,66 +1178,89 @@ func (self *Endpoint) HasOption(name string) bool {
 	return false
 }
 
-func parseParameterType(parameterType interface{}, fields map[string]interface{}) rest.Parameter{
+func parseParameterType(parameterType interface{}, fields map[string]interface{}, ctx *parseContext) rest.Parameter{
 	switch parameterType {
 	case tString:
 		result := new(StringParameter)
-		result.parse(fields)
+		result.parse(fields, ctx)
 		return result
 	case tBoolean:
 		result := new(BooleanParameter)
-		result.parse(fields)
+		result.parse(fields, ctx)
 		return result
 	case tInteger:
 		result := new(IntegerParameter)
-		result.parse(fields)
+		result.parse(fields, ctx)
 		return result
 	case tNumber:
 		result := new(NumberParameter)
-		result.parse(fields)
+		result.parse(fields, ctx)
 		return result
 	case tFile:
 		result := new(FileParameter)
-		result.parse(fields)
+		result.parse(fields, ctx)
 		return result
 	case tAny:
 		result := new(AnyParameter)
-		result.parse(fields)
+		result.parse(fields, ctx)
 		return result
-	case tString + "[]":
-		fields[fItems] = tString
-		return parseParameterType(tArray, fields)
-	case tInteger + "[]":
-		fields[fItems] = tInteger
-		return parseParameterType(tArray, fields)
-	case tNumber + "[]":
-		fields[fItems] = tNumber
-		return parseParameterType(tArray, fields)
-	case tBoolean + "[]":
-		fields[fItems] = tBoolean
-		return parseParameterType(tArray, fields)
 	case tArray:
 		result := new(ArrayParameter)
-		result.parse(fields)
+		result.parse(fields, ctx)
+		return result
+	case tObject:
+		result := new(ObjectParameter)
+		result.parse(fields, ctx)
 		return result
-	default:
-		log.Fatalf("Unsupported parameter type %s", parameterType)
-		return nil //never happens
 	}
+	switch expression := parameterType.(type) {
+	case string:
+		if members := splitUnion(expression); len(members) > 1 { //union such as 'string | integer'
+			result := new(UnionParameter)
+			result.parse(fields, members, ctx)
+			return result
+		} else if strings.HasSuffix(expression, "[]") { //array such as 'Person[]'
+			fields[fItems] = strings.TrimSuffix(expression, "[]")
+			return parseParameterType(tArray, fields, ctx)
+		} else if strings.HasPrefix(expression, "(") && strings.HasSuffix(expression, ")") {
+			return parseParameterType(strings.TrimSpace(expression[1:len(expression) - 1]), fields, ctx)
+		} else if ctx.types.declares(expression) {
+			ctx = ctx.withinDeclaration()
+			fields = ctx.types.inherit(expression, fields, ctx)
+			ctx.types.resolving[expression] = true
+			defer delete(ctx.types.resolving, expression)
+			return parseFields(fields, ctx)
+		}
+	case []interface{}: //multiple inheritance
+		ctx = ctx.withinDeclaration()
+		return parseFields(ctx.types.inherit(expression, fields, ctx), ctx)
+	}
+	ctx.reportf("Unsupported parameter type %v", parameterType)
+	return parseParameterType(tAny, fields, ctx)
 }
 
-func parseParameter(description interface{}) rest.Parameter {
-	if tree, ok := description.(yaml.MapSlice); ok {
-		//convert parameter fields into map
-		fields := mapSliceToMap(tree)
-		//parse parameter fields
-		if parameterType, ok := fields[fType]; ok {
-			return parseParameterType(parameterType, fields)
-		} else {
-			return parseParameterType(tAny, fields)
-		}
+//restores parameter from its facets
+func parseFields(fields map[string]interface{}, ctx *parseContext) rest.Parameter {
+	if parameterType, ok := fields[fType]; ok {
+		return parseParameterType(parameterType, fields, ctx)
+	} else if _, ok := fields[fProperties]; ok { //type with properties is object by default
+		return parseParameterType(tObject, fields, ctx)
 	} else {
-		log.Printf("Parameter has incorrect declaration: %+v", description)
+		return parseParameterType(tAny, fields, ctx)
+	}
+}
+
+func parseParameter(description interface{}, ctx *parseContext) rest.Parameter {
+	switch description := description.(type) {
+	case yaml.MapSlice:
+		//convert parameter fields into map
+		return parseFields(mapSliceToMap(description), ctx)
+	case string: //declaration contains name of type only
+		return parseParameterType(description, make(map[string]interface{}), ctx)
+	case nil: //declaration without facets means any type
+		return parseParameterType(tAny, make(map[string]interface{}), ctx)
+	default:
+		ctx.reportf("Parameter has incorrect declaration: %+v", description)
 		return &StringParameter{
 			pattern:      nil,
 			defaultValue: "",
@@ -892,47 +1269,61 @@ func parseParameter(description interface{}) rest.Parameter {
 	}
 }
 
-func parseParameterList(input interface{}, output rest.ParameterList) {
-	if tree, ok := input.(yaml.MapSlice); ok {
+//Restores parameter from its description expressed in terms of RAML facets.
+//Can be used by readers of other model formats with compatible type system
+func ParseParameter(description yaml.MapSlice) (rest.Parameter, error) {
+	ctx := newParseContext(nil, nil)
+	result := parseParameter(description, ctx)
+	return result, ctx.err()
+}
+
+func parseParameterList(input interface{}, output rest.ParameterList, ctx *parseContext) {
+	switch tree := input.(type) {
+	case yaml.MapSlice:
 		for _, item := range tree { //iterate over parameters
 			if name, ok := item.Key.(string); ok {
 				log.Printf("Start parsing parameter %s", name)
-				output[name] = parseParameter(item.Value)	//parse parameter
+				output[name] = parseParameter(item.Value, ctx.child(item.Key))	//parse parameter
 			}
 		}
-	} else {
-		log.Printf("Unexpected tree type inside of parameter list: %+v", input)
+	case nil:
+		return
+	default:
+		ctx.reportf("Unexpected tree type inside of parameter list: %+v", input)
 	}
 }
 
-func (self *Endpoint) parseMethod(method string, description interface{}){
+func (self *Endpoint) parseMethod(method string, description interface{}, defaultTimeout time.Duration, ctx *parseContext){
 	m := new(MethodDescriptor)
-	m.parse(description)
+	m.parse(description, defaultTimeout, ctx)
 	self.methods[method] = m
 }
 
-func (self *Endpoint) parse(tree interface{}) {
-	if t, ok := tree.(yaml.MapSlice); ok {
+func (self *Endpoint) parse(tree interface{}, defaultTimeout time.Duration, ctx *parseContext) {
+	switch t := tree.(type) {
+	case yaml.MapSlice:
 		for _, item := range t {
 			switch item.Key {
 			case "uriParameters":
-				parseParameterList(item.Value, self.uriParameters)
+				parseParameterList(item.Value, self.uriParameters, ctx.child(item.Key))
 			case "get":
-				self.parseMethod(http.MethodGet, item.Value)
+				self.parseMethod(http.MethodGet, item.Value, defaultTimeout, ctx.child(item.Key))
 			case "post":
-				self.parseMethod(http.MethodPost, item.Value)
+				self.parseMethod(http.MethodPost, item.Value, defaultTimeout, ctx.child(item.Key))
 			case "put":
-				self.parseMethod(http.MethodPut, item.Value)
+				self.parseMethod(http.MethodPut, item.Value, defaultTimeout, ctx.child(item.Key))
 			case "delete":
-				self.parseMethod(http.MethodDelete, item.Value)
+				self.parseMethod(http.MethodDelete, item.Value, defaultTimeout, ctx.child(item.Key))
 			case "patch":
-				self.parseMethod(http.MethodPatch, item.Value)
+				self.parseMethod(http.MethodPatch, item.Value, defaultTimeout, ctx.child(item.Key))
 			case "head":
-				self.parseMethod(http.MethodHead, item.Value)
+				self.parseMethod(http.MethodHead, item.Value, defaultTimeout, ctx.child(item.Key))
 			}
 		}
-	} else {
-		log.Printf("Unexpected tree type inside of endpoint: %+v", tree)
+	case nil:
+		return
+	default:
+		ctx.reportf("Unexpected tree type inside of endpoint: %+v", tree)
 	}
 }
 
@@ -941,22 +1332,56 @@ func (self *Endpoint) PathParameters() rest.ParameterList {
 }
 
 func (self *Endpoint) GetMethodDescriptor(method string) rest.HttpMethodDescriptor {
-	return self.methods[method]
+	//avoid conversion of nil pointer into non-nil interface
+	if method, ok := self.methods[method]; ok {
+		return method
+	} else {
+		return nil
+	}
 }
 
 //Represents REST model restored from RAML markup
 type Model struct {
+	DefaultTimeout time.Duration	//execution timeout of methods without (timeout) annotation. Zero means no timeout
 	title string
 	baseUri *url.URL
 	endpoints map[string]rest.Endpoint
 }
 
-func (self *Model) newEndpoint(name string) *Endpoint {
+func newEndpoint(uriParameters rest.ParameterList) *Endpoint {
 	endpoint := &Endpoint{uriParameters: make(rest.ParameterList), methods: make(map[string]*MethodDescriptor)}
-	self.endpoints[name] = endpoint
+	//URI parameters of parent resource are inherited by nested resource
+	for name, parameter := range uriParameters {
+		endpoint.uriParameters[name] = parameter
+	}
 	return endpoint
 }
 
+//parses resource and its nested resources. Path of nested resource is relative to the parent resource
+func (self *Model) parseResource(path string, tree interface{}, uriParameters rest.ParameterList, templates *templates, ctx *parseContext) {
+	log.Printf("Start parsing endpoint %s", path)
+	//resource type and traits are applied before parsing
+	if expanded, err := templates.apply(path, tree); err == nil {
+		tree = expanded
+	} else {
+		ctx.report(err)
+		return
+	}
+	endpoint := newEndpoint(uriParameters)
+	endpoint.parse(tree, self.DefaultTimeout, ctx)
+	//resource without methods is used for grouping of nested resources only
+	if len(endpoint.methods) > 0 {
+		self.endpoints[path] = endpoint
+	}
+	if tree, ok := tree.(yaml.MapSlice); ok {
+		for _, item := range tree {
+			if name, ok := item.Key.(string); ok && strings.HasPrefix(name, "/") {
+				self.parseResource(strings.TrimSuffix(path, "/") + name, item.Value, endpoint.uriParameters, templates, ctx.child(name))
+			}
+		}
+	}
+}
+
 func (self *Model) Endpoints() map[string]rest.Endpoint {
 	return self.endpoints
 }
@@ -965,51 +1390,80 @@ func (self *Model) Name() string {
 	return self.title
 }
 
-func (self *Model) parse(model yaml.MapSlice) {
+//parses the model and returns all problems found in it together with problems found by the loader
+func (self *Model) parse(model yaml.MapSlice, loader *documentLoader) error {
 	self.endpoints = make(map[string]rest.Endpoint)
+	ctx := newParseContext(loader.positions, loader.problems)
+	//types should be declared before endpoints referring to them
+	if types, ok := mapSliceToMap(model)[fTypes]; ok {
+		ctx.types = newTypeRegistry(types, ctx.child(fTypes))
+		//each declaration is validated once, problems of the type are not reported again for each reference to it
+		if types, ok := types.(yaml.MapSlice); ok {
+			for _, item := range types {
+				parseParameterType(item.Key, make(map[string]interface{}), ctx.child(fTypes, item.Key))
+			}
+		}
+	}
+	templates := newTemplates(mapSliceToMap(model))
+	validateTemplates(mapSliceToMap(model), ctx)
 	for _, item := range model {
 		if field, ok := item.Key.(string); ok {
 			switch field {
 			case fTitle:
-				self.title = item.Value.(string)
+				if title, ok := item.Value.(string); ok {
+					self.title = title
+				} else {
+					ctx.child(field).reportf("Title should be a string")
+				}
 			case fBaseUri:
-				if baseUri, err := url.Parse(item.Value.(string)); err == nil {
+				if baseUri, ok := item.Value.(string); !ok {
+					ctx.child(field).reportf("Base URI should be a string")
+				} else if baseUri, err := url.Parse(baseUri); err == nil {
 					self.baseUri = baseUri
 				} else {
-					log.Printf("Failed to parse base URI: %s", err.Error())
+					ctx.child(field).reportf("Failed to parse base URI: %s", err.Error())
 				}
 			default:
 				if strings.Index(field, "/") == 0 { //endpoint detected
-					log.Printf("Start parsing endpoint %s", field)
-					self.newEndpoint(field).parse(item.Value)
+					self.parseResource(field, item.Value, nil, templates, ctx.child(field))
 				}
 			}
 		}
 	}
+	return ctx.err()
 }
 
-//Read RAML model
-func (self *Model) ReadModel(input io.Reader) error {
-	if content, err := ioutil.ReadAll(input); err == nil {
-		parsedYAML := &yaml.MapSlice{}
-		if err := yaml.Unmarshal(content, parsedYAML); err == nil {
-			self.parse(*parsedYAML)
-			return nil
-		} else {
-			return err
-		}
-	} else {
+//reads RAML model. Relative paths of included files and libraries are resolved from the directory
+func (self *Model) readModel(input io.Reader, directory string) error {
+	loader := newDocumentLoader()
+	if content, err := ioutil.ReadAll(input); err != nil {
 		return err
+	} else if document, err := loader.readModel(content, directory); err == nil {
+		return self.parse(document, loader)
+	} else {
+		return loader.failure(err)
 	}
 }
 
-//Read RAML model from file
-func (self *Model) ReadModelFromFile(fileName string) error {
-	if file, err := os.Open(fileName); err == nil {
-		defer file.Close()
-		return self.ReadModel(file)
+//Read RAML model. Relative paths of included files are resolved from the current directory.
+//Problems of the model are returned as ModelErrors
+func (self *Model) ReadModel(input io.Reader) error {
+	return self.readModel(input, ".")
+}
+
+//Read RAML model from file and apply overlays and extensions in the specified order.
+//Problems of the model are returned as ModelErrors
+func (self *Model) ReadModelFromFile(fileName string, extensions ...string) error {
+	loader := newDocumentLoader()
+	if document, err := loader.readModelFile(fileName); err == nil {
+		for _, extension := range extensions {
+			if document, err = loader.readExtensionFile(document, extension); err != nil {
+				return loader.failure(err)
+			}
+		}
+		return self.parse(document, loader)
 	} else {
-		return err
+		return loader.failure(err)
 	}
 }
 
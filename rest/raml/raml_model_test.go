@@ -6,7 +6,13 @@ import (
 	"math"
 	"reflect"
 	"github.com/sakno/go2rest/rest"
+	"github.com/sakno/go2rest/cmdexec"
 	"net/http"
+	"gopkg.in/yaml.v2"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
 )
 
 func testFormatParameter(endpoint rest.Endpoint, t *testing.T){
@@ -195,6 +201,10 @@ func testGetMethod(endpoint rest.Endpoint, t *testing.T) {
 				if _, ok := response.Body.(rest.StringParameter); !ok {
 					t.Fatalf("Incorrect type of parameter")
 				}
+			case cmdexec.ExitCodeTimeout:
+				if response.StatusCode != 408 {
+					t.Fatalf("Incorrect status code %v", response.StatusCode)
+				}
 			default:
 				t.Fatalf("Unexpected exit code %v", exitCode)
 			}
@@ -235,6 +245,20 @@ func TestIntegerDeserialization(t *testing.T) {
 	}
 }
 
+func TestIntegerValidation(t *testing.T) {
+	parameter, err := ParseParameter(yaml.MapSlice{{Key: fProperties, Value: yaml.MapSlice{{Key: "age", Value: "integer"}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//numbers of JSON object are decoded as float64
+	if !parameter.Validate(map[string]interface{}{"age": 30.0}) {
+		t.Fatal("Integer value is not accepted")
+	}
+	if parameter.Validate(map[string]interface{}{"age": 30.7}) {
+		t.Fatal("Fractional value is accepted as integer")
+	}
+}
+
 func TestStringDeserialization(t *testing.T) {
 	parameter := new(StringParameter)
 	parameter.init()
@@ -285,3 +309,434 @@ func TestArrayDeserialization(t *testing.T) {
 
 
 
+
+func TestObjectParameter(t *testing.T) {
+	parameter, err := ParseParameter(yaml.MapSlice{
+		{Key: fAdditionalProperties, Value: false},
+		{Key: fProperties, Value: yaml.MapSlice{
+			{Key: "name", Value: "string"},
+			{Key: "age?", Value: "integer"},
+			{Key: "address", Value: yaml.MapSlice{{Key: fProperties, Value: yaml.MapSlice{{Key: "city", Value: "string"}}}}},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if object, ok := parameter.(rest.ObjectParameter); ok {
+		if object.AdditionalProperties() {
+			t.Fatal("Additional properties should be disabled")
+		}
+		if fields := object.Fields(); len(fields) != 3 || fields["age"] == nil || fields["age"].Required() || !fields["name"].Required() {
+			t.Fatalf("Unexpected fields %v", fields)
+		} else if _, ok := fields["address"].(rest.ObjectParameter); !ok {
+			t.Fatal("Nested object expected")
+		}
+	} else {
+		t.Fatal("Incorrect type of object parameter")
+	}
+	if value, err := parameter.ReadValue(strings.NewReader(`{"name": "Alice", "address": {"city": "Paris"}}`), rest.FormatJSON); err != nil {
+		t.Fatal(err)
+	} else if !parameter.Validate(value) {
+		t.Fatal("Object validation test failed")
+	}
+	if parameter.Validate(map[string]interface{}{"name": "Alice", "address": map[string]interface{}{}}) {
+		t.Fatal("Required field of nested object is not validated")
+	}
+	if parameter.Validate(map[string]interface{}{"name": "Alice", "address": map[string]interface{}{"city": "Paris"}, "phone": "123"}) {
+		t.Fatal("Additional properties are not validated")
+	}
+}
+
+const typesModel = `#%RAML 1.0
+title: Types
+types:
+  Age:
+    type: integer
+    minimum: 0
+  Named:
+    properties:
+      name: string
+  Aged:
+    properties:
+      age?: Age
+  Person:
+    type: [Named, Aged]
+    additionalProperties: false
+  Employee:
+    type: Person
+    properties:
+      salary: number
+  Id: string | integer
+/employees/{id}:
+  uriParameters:
+    id: Id
+  put:
+    (commandPattern): echo {{.id}}
+    queryParameters:
+      age:
+        type: Age
+        maximum: 150
+    body:
+      application/json: Employee
+`
+
+func TestUserDefinedTypes(t *testing.T) {
+	model := new(Model)
+	if err := model.ReadModel(strings.NewReader(typesModel)); err != nil {
+		t.Fatal(err)
+	}
+	endpoint := model.Endpoints()["/employees/{id}"]
+	if endpoint == nil {
+		t.Fatal("Endpoint is not parsed")
+	}
+	//union type
+	id := endpoint.PathParameters()["id"]
+	if _, ok := id.(rest.UnionParameter); !ok {
+		t.Fatal("Incorrect type of 'id' parameter")
+	}
+	if value, err := id.ReadValue(strings.NewReader("42"), rest.FormatText); err != nil || value != "42" {
+		t.Fatalf("Incorrect deserialization of union: %v", value)
+	}
+	if !id.Validate(int64(42)) || id.Validate(true) {
+		t.Fatal("Union validation test failed")
+	}
+	method := endpoint.GetMethodDescriptor(http.MethodPut)
+	//facets of user-defined type are overridden by declaration
+	if age, ok := method.QueryParameters()["age"].(rest.IntegerParameter); !ok {
+		t.Fatal("Incorrect type of 'age' parameter")
+	} else if !age.Validate(100) || age.Validate(-1) || age.Validate(151) {
+		t.Fatal("Range validation failed")
+	}
+	//properties are inherited from all base types
+	if employee, ok := method.Request()["application/json"].(rest.ObjectParameter); !ok {
+		t.Fatal("Incorrect type of request body")
+	} else if fields := employee.Fields(); len(fields) != 3 || fields["age"].Required() || !fields["salary"].Required() {
+		t.Fatalf("Unexpected fields %v", fields)
+	} else if employee.AdditionalProperties() {
+		t.Fatal("Additional properties should be disabled")
+	} else if !employee.Validate(map[string]interface{}{"name": "Alice", "age": 30.0, "salary": 10.0}) || employee.Validate(map[string]interface{}{"name": "Alice", "age": -1.0, "salary": 10.0}) {
+		t.Fatal("Object validation test failed")
+	}
+}
+
+func TestIncludesAndLibraries(t *testing.T) {
+	model := new(Model)
+	if err := model.ReadModelFromFile("test-include-model.raml"); err != nil {
+		t.Fatal(err)
+	}
+	endpoint := model.Endpoints()["/employees/{id}"]
+	if endpoint == nil {
+		t.Fatal("Endpoint is not parsed")
+	}
+	if _, ok := endpoint.PathParameters()["id"].(rest.IntegerParameter); !ok {
+		t.Fatal("Incorrect type of 'id' parameter")
+	}
+	method := endpoint.GetMethodDescriptor(http.MethodPut)
+	//type inherited from library includes property declared in another library
+	if employee, ok := method.Request()["application/json"].(rest.ObjectParameter); !ok {
+		t.Fatal("Incorrect type of request body")
+	} else if fields := employee.Fields(); len(fields) != 3 {
+		t.Fatalf("Unexpected fields %v", fields)
+	} else if fields["age"].Validate(-1) || !fields["age"].Validate(30) {
+		t.Fatal("Range validation failed")
+	}
+	//command pattern is included from text file
+	output := new(bytes.Buffer)
+	if err := method.Executor()(context.Background(), cmdexec.Arguments{"id": 42}, nil, output); err != nil {
+		t.Fatal(err)
+	} else if output.String() != "42\n" {
+		t.Fatalf("Unexpected output %q", output.String())
+	}
+}
+
+func TestLibraryTemplates(t *testing.T) {
+	model := new(Model)
+	if err := model.ReadModelFromFile("test-include-model.raml"); err != nil {
+		t.Fatal(err)
+	}
+	method := model.Endpoints()["/items"].GetMethodDescriptor(http.MethodGet)
+	//resource type of the library inherits another resource type and applies trait of the same library
+	if response, ok := method.Response()[1]; !ok || response.StatusCode != 500 {
+		t.Fatal("Base resource type is not applied")
+	} else if page, ok := method.QueryParameters()["page"].(rest.IntegerParameter); !ok {
+		t.Fatal("Trait is not applied")
+	} else if page.Validate(0) || !page.Validate(1) {
+		t.Fatal("Type of the library is not applied to parameter of the trait")
+	}
+}
+
+func TestTemplateFunctions(t *testing.T) {
+	for expression, expected := range map[string]string{
+		"<<name | !singularize>>": "category",
+		"<<item | !pluralize | !uppercase>>": "CATEGORIES",
+		"<<id | !uppercamelcase>>": "UserId",
+		"<<id | !lowerhyphencase>>": "user-id",
+		"<<id | !upperunderscorecase>>": "USER_ID",
+		"/<<name>>/{id}": "/categories/{id}",
+	} {
+		if value, err := substitute(expression, map[string]interface{}{"name": "categories", "item": "category", "id": "userId"}); err != nil {
+			t.Fatal(err)
+		} else if value != expected {
+			t.Fatalf("Unexpected value %v of %s", value, expression)
+		}
+	}
+	if _, err := substitute("<<missing>>", map[string]interface{}{}); err == nil {
+		t.Fatal("Missing parameter is not detected")
+	}
+}
+
+const traitResponsesModel = `#%RAML 1.0
+title: Traits
+traits:
+  failing:
+    responses:
+      200:
+        (exitCode): 0
+      500:
+        (exitCode): 1
+        body:
+          text/plain: string
+/count:
+  get:
+    is: [failing]
+    (commandPattern): echo 1
+    responses:
+      200:
+        body:
+          text/plain: integer
+`
+
+func TestTraitResponses(t *testing.T) {
+	model := new(Model)
+	if err := model.ReadModel(strings.NewReader(traitResponsesModel)); err != nil {
+		t.Fatal(err)
+	}
+	//response of the trait is merged with response of the method with the same status code
+	responses := model.Endpoints()["/count"].GetMethodDescriptor(http.MethodGet).Response()
+	if len(responses) != 2 {
+		t.Fatalf("Unexpected responses %v", responses)
+	} else if response := responses[0]; response.StatusCode != 200 {
+		t.Fatalf("Unexpected status code %v", response.StatusCode)
+	} else if _, ok := response.Body.(*IntegerParameter); !ok {
+		t.Fatal("Body of the response is not merged")
+	} else if responses[1].StatusCode != 500 {
+		t.Fatalf("Unexpected status code %v", responses[1].StatusCode)
+	}
+}
+
+func testOverlayCommand(model *Model, t *testing.T) {
+	output := new(bytes.Buffer)
+	method := model.Endpoints()["/freemem/{format}"].GetMethodDescriptor(http.MethodGet)
+	if err := method.Executor()(context.Background(), cmdexec.Arguments{"format": "abc"}, nil, output); err != nil {
+		t.Fatal(err)
+	} else if output.String() != "abc\n" {
+		t.Fatalf("Command pattern is not overridden by overlay: %q", output.String())
+	}
+}
+
+func TestOverlaysAndExtensions(t *testing.T) {
+	model := new(Model)
+	if err := model.ReadModelFromFile("test-raml-model.raml", "test-overlay.raml", "test-extension.raml"); err != nil {
+		t.Fatal(err)
+	}
+	if model.Name() != "Test API (production)" {
+		t.Fatalf("Unexpected title %s", model.Name())
+	}
+	testOverlayCommand(model, t)
+	if _, ok := model.Endpoints()["/uptime"]; !ok {
+		t.Fatal("Resource is not added by extension")
+	}
+	//extension changes body of the response only
+	if response := model.Endpoints()["/freemem/{format}"].GetMethodDescriptor(http.MethodGet).Response()[0]; response.StatusCode != 200 {
+		t.Fatalf("Unexpected status code %v", response.StatusCode)
+	} else if _, ok := response.Body.(*IntegerParameter); !ok {
+		t.Fatal("Body of the response is not overridden by extension")
+	}
+	//overlay refers to the base document
+	model = new(Model)
+	if err := model.ReadModelFromFile("test-overlay.raml"); err != nil {
+		t.Fatal(err)
+	}
+	testOverlayCommand(model, t)
+	//overlay cannot add resources
+	overlay := filepath.Join(t.TempDir(), "invalid-overlay.raml")
+	if base, err := filepath.Abs("test-raml-model.raml"); err != nil {
+		t.Fatal(err)
+	} else if err := os.WriteFile(overlay, []byte("#%RAML 1.0 Overlay\nextends: " + base + "\n/uptime:\n  get:\n    (commandPattern): uptime\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := new(Model).ReadModelFromFile(overlay); err == nil {
+		t.Fatal("Overlay should not add resources")
+	}
+}
+
+const invalidModel = `#%RAML 1.0
+title: Invalid
+types:
+  Code:
+    type: string
+    pattern: "[a-"
+/users:
+  get:
+    (commandPattern): echo {{.page}}
+    queryParameters:
+      page:
+        type: integer
+        default: first
+      owner: Person
+    responses:
+      200:
+        body:
+          text/plain: Code
+`
+
+func TestModelErrors(t *testing.T) {
+	err := new(Model).ReadModel(strings.NewReader(invalidModel))
+	problems, ok := err.(ModelErrors)
+	if !ok {
+		t.Fatalf("Model errors expected instead of %v", err)
+	}
+	//problem of user-defined type is reported once at its declaration
+	expected := []struct{ line int; path string }{
+		{6, "/types/Code/pattern"},
+		{13, "/users/get/queryParameters/page/default"},
+		{14, "/users/get/queryParameters/owner"},
+		{16, "/users/get/responses/200"},
+	}
+	if len(problems) != len(expected) {
+		t.Fatalf("Unexpected problems:\n%s", problems.Error())
+	}
+	for index, problem := range problems {
+		if problem.Line != expected[index].line || problem.Path != expected[index].path {
+			t.Fatalf("Unexpected location of problem %s", problem.Error())
+		}
+	}
+	//syntax error
+	err = new(Model).ReadModel(strings.NewReader("#%RAML 1.0\ntitle: Invalid\n/users:\n  get: [\n"))
+	if problem, ok := err.(*ModelError); !ok || problem.Line != 4 || !strings.HasPrefix(problem.Error(), "4:1: ") {
+		t.Fatalf("Syntax error with line number expected instead of %v", err)
+	}
+}
+
+func TestInvalidTemplates(t *testing.T) {
+	const model = "#%RAML 1.0\ntitle: Invalid\nresourceTypes:\n  collection: [get]\ntraits:\n  paged: 5\n/users:\n  get:\n    is: [paged]\n    (commandPattern): echo users\n"
+	err := new(Model).ReadModel(strings.NewReader(model))
+	problems, ok := err.(ModelErrors)
+	if !ok {
+		t.Fatalf("Model errors expected instead of %v", err)
+	}
+	//malformed declarations are reported even if they are not applied
+	expected := []struct{ line int; path string }{
+		{4, "/resourceTypes/collection"},
+		{6, "/traits/paged"},
+	}
+	if len(problems) != len(expected) {
+		t.Fatalf("Unexpected problems:\n%s", problems.Error())
+	}
+	for index, problem := range problems {
+		if problem.Line != expected[index].line || problem.Path != expected[index].path {
+			t.Fatalf("Unexpected location of problem %s", problem.Error())
+		}
+	}
+}
+
+func TestLoaderErrors(t *testing.T) {
+	directory := t.TempDir()
+	const model = "#%RAML 1.0\ntitle: Broken\nuses:\n  missing: missing.raml\n  broken: broken.raml\n/users:\n  get:\n    (commandPattern): echo users\n    description: !include missing.txt\n    displayName: !include missing.yaml\n"
+	fileName := filepath.Join(directory, "main.raml")
+	if err := os.WriteFile(fileName, []byte(model), 0644); err != nil {
+		t.Fatal(err)
+	} else if err := os.WriteFile(filepath.Join(directory, "broken.raml"), []byte("#%RAML 1.0 Library\ntypes:\n  User: [\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	problems, ok := new(Model).ReadModelFromFile(fileName).(ModelErrors)
+	if !ok {
+		t.Fatal("Model errors expected")
+	}
+	//loading continues after broken library and missing files
+	expected := []struct{ file string; line int }{
+		{"broken.raml", 3},
+		{"main.raml", 4},
+		{"main.raml", 9},
+		{"main.raml", 10},
+	}
+	if len(problems) != len(expected) {
+		t.Fatalf("Unexpected problems:\n%s", problems.Error())
+	}
+	for index, problem := range problems {
+		if filepath.Base(problem.File) != expected[index].file || problem.Line != expected[index].line {
+			t.Fatalf("Unexpected location of problem %s", problem.Error())
+		}
+	}
+}
+
+const invalidFormModel = `#%RAML 1.0
+title: Invalid forms
+/upload:
+  post:
+    (commandPattern): cat {{.data}}
+    body:
+      application/x-www-form-urlencoded:
+        properties:
+          data: file
+      multipart/form-data:
+        properties:
+          body: string
+`
+
+func TestInvalidFormFields(t *testing.T) {
+	err := new(Model).ReadModel(strings.NewReader(invalidFormModel))
+	problems, ok := err.(ModelErrors)
+	if !ok {
+		t.Fatalf("Model errors expected instead of %v", err)
+	}
+	expected := []string{"/upload/post/body/application/x-www-form-urlencoded", "/upload/post/body/multipart/form-data"}
+	if len(problems) != len(expected) {
+		t.Fatalf("Unexpected problems:\n%s", problems.Error())
+	}
+	for index, problem := range problems {
+		if problem.Path != expected[index] {
+			t.Fatalf("Unexpected location of problem %s", problem.Error())
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	const model = "#%RAML 1.0\ntitle: Timeout\n/unlimited:\n  get:\n    (commandPattern): echo\n    (timeout): 0\n/negative:\n  get:\n    (commandPattern): echo\n    (timeout): -5s\n"
+	err := new(Model).ReadModel(strings.NewReader(model))
+	//zero means no timeout so only negative timeout is reported
+	if problems, ok := err.(ModelErrors); !ok || len(problems) != 1 || problems[0].Path != "/negative/get/(timeout)" {
+		t.Fatalf("Negative timeout should be reported instead of %v", err)
+	}
+}
+
+const invalidOutputModel = `#%RAML 1.0
+title: Invalid output
+/image:
+  get:
+    (commandPattern): convert {{.output}}
+    responses:
+      200:
+        (exitCode): 0
+        (outputFile): ../image.png
+        body:
+          image/png: file
+      201:
+        (exitCode): 1
+        (outputFile): /tmp/image.png
+        body:
+          image/png: file
+      202:
+        (exitCode): 2
+        (outputFile): .png
+        body:
+          image/png: file
+`
+
+func TestOutputFileOutsideOfTempDir(t *testing.T) {
+	err := new(Model).ReadModel(strings.NewReader(invalidOutputModel))
+	//extension of the output file is accepted
+	if problems, ok := err.(ModelErrors); !ok || len(problems) != 2 || problems[0].Path != "/image/get/responses/200/(outputFile)" || problems[1].Path != "/image/get/responses/201/(outputFile)" {
+		t.Fatalf("Output files outside of temporary directory should be reported instead of %v", err)
+	}
+}
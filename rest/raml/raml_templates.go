@@ -0,0 +1,426 @@
+package raml
+
+import (
+	"gopkg.in/yaml.v2"
+	"regexp"
+	"strings"
+	"unicode"
+	"errors"
+	"fmt"
+)
+
+const (
+	fResourceTypes = "resourceTypes"
+	fTraits = "traits"
+	fIs = "is"
+	//reserved parameters of resource types and traits
+	paramResourcePath = "resourcePath"
+	paramResourcePathName = "resourcePathName"
+	paramMethodName = "methodName"
+)
+
+//parameter of resource type or trait with optional transformations, e.g. '<<resourcePathName | !singularize>>'
+var templateParamPattern = regexp.MustCompile(`<<\s*([^<>|\s]+)\s*((?:\|\s*![A-Za-z]+\s*)*)>>`)
+
+var templateFunctionPattern = regexp.MustCompile(`![A-Za-z]+`)
+
+//methods which can be declared by resource
+var resourceMethods = []string{"get", "post", "put", "delete", "patch", "head"}
+
+//Declarations of resource types and traits which are applied to resources and methods
+type templates struct {
+	resourceTypes map[string]interface{}
+	traits map[string]interface{}
+}
+
+func newTemplates(model map[string]interface{}) *templates {
+	result := &templates{resourceTypes: make(map[string]interface{}), traits: make(map[string]interface{})}
+	if resourceTypes, ok := model[fResourceTypes].(yaml.MapSlice); ok {
+		result.resourceTypes = mapSliceToMap(resourceTypes)
+	}
+	if traits, ok := model[fTraits].(yaml.MapSlice); ok {
+		result.traits = mapSliceToMap(traits)
+	}
+	return result
+}
+
+//reports declarations of resource types and traits which are not maps. Such declarations can't be applied to resources and methods
+func validateTemplates(model map[string]interface{}, ctx *parseContext) {
+	for section, kind := range map[string]string{fResourceTypes: "Resource type", fTraits: "Trait"} {
+		switch declarations := model[section].(type) {
+		case nil:
+		case yaml.MapSlice:
+			for _, item := range declarations {
+				if _, ok := item.Value.(yaml.MapSlice); !ok && item.Value != nil {
+					ctx.child(section, item.Key).reportf("%s %v should be a map", kind, item.Key)
+				}
+			}
+		default:
+			ctx.child(section).reportf("%s declarations should be a map", kind)
+		}
+	}
+}
+
+//extracts name of resource type or trait and its parameters from reference such as '{ collection: { item: User } }'
+func templateReference(reference interface{}) (string, map[string]interface{}, error) {
+	switch reference := reference.(type) {
+	case string:
+		return reference, make(map[string]interface{}), nil
+	case yaml.MapSlice:
+		if len(reference) == 1 {
+			if parameters, ok := reference[0].Value.(yaml.MapSlice); ok {
+				return fmt.Sprint(reference[0].Key), mapSliceToMap(parameters), nil
+			} else if reference[0].Value == nil {
+				return fmt.Sprint(reference[0].Key), make(map[string]interface{}), nil
+			}
+		}
+	}
+	return "", nil, errors.New(fmt.Sprintf("Invalid reference to resource type or trait: %+v", reference))
+}
+
+//returns the rightmost segment of the path which is not URI parameter
+func resourcePathName(path string) string {
+	segments := strings.Split(path, "/")
+	for index := len(segments) - 1; index >= 0; index-- {
+		if segment := segments[index]; len(segment) > 0 && !strings.HasPrefix(segment, "{") {
+			return segment
+		}
+	}
+	return ""
+}
+
+//applies resource type and traits to the resource and its methods
+func (self *templates) apply(path string, tree interface{}) (interface{}, error) {
+	resource, ok := tree.(yaml.MapSlice)
+	if !ok {
+		return tree, nil
+	}
+	parameters := map[string]interface{}{paramResourcePath: path, paramResourcePathName: resourcePathName(path)}
+	if resourceType, ok := mapSliceToMap(resource)[fType]; ok {
+		if resourceType, err := self.resourceType(resourceType, parameters, 0); err == nil {
+			resource = mergeResource(resourceType, resource)
+		} else {
+			return nil, err
+		}
+	}
+	//traits of resource are applied to each method of the resource
+	traits := toList(mapSliceToMap(resource)[fIs])
+	result := make(yaml.MapSlice, 0, len(resource))
+	for _, item := range resource {
+		if item.Key == fType || item.Key == fIs {
+			continue
+		} else if name, ok := item.Key.(string); ok && isResourceMethod(name) {
+			if method, err := self.applyTraits(name, item.Value, traits, parameters); err == nil {
+				item.Value = method
+			} else {
+				return nil, err
+			}
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+func isResourceMethod(name string) bool {
+	for _, method := range resourceMethods {
+		if method == name {
+			return true
+		}
+	}
+	return false
+}
+
+func toList(value interface{}) []interface{} {
+	switch value := value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return value
+	default:
+		return []interface{}{value}
+	}
+}
+
+//returns declaration of resource type with substituted parameters. Resource type can inherit another resource type
+func (self *templates) resourceType(reference interface{}, parameters map[string]interface{}, depth int) (yaml.MapSlice, error) {
+	if depth > len(self.resourceTypes) {
+		return nil, errors.New("Resource type is declared recursively")
+	} else if name, arguments, err := templateReference(reference); err != nil {
+		return nil, err
+	} else if declaration, ok := self.resourceTypes[name]; !ok {
+		return nil, errors.New(fmt.Sprintf("Resource type %s is not declared", name))
+	} else if declaration, err := substitute(declaration, withArguments(parameters, arguments)); err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to apply resource type %s. Error: %s", name, err.Error()))
+	} else if declaration, ok := declaration.(yaml.MapSlice); !ok {
+		return nil, errors.New(fmt.Sprintf("Resource type %s should be a map", name))
+	} else if base, ok := mapSliceToMap(declaration)[fType]; ok {
+		if base, err := self.resourceType(base, parameters, depth + 1); err == nil {
+			return mergeResource(base, declaration), nil
+		} else {
+			return nil, err
+		}
+	} else {
+		return declaration, nil
+	}
+}
+
+//applies traits declared by the method and traits inherited from the resource
+func (self *templates) applyTraits(methodName string, tree interface{}, inherited []interface{}, parameters map[string]interface{}) (interface{}, error) {
+	method, ok := tree.(yaml.MapSlice)
+	if !ok {
+		if len(inherited) == 0 {
+			return tree, nil
+		}
+		method = make(yaml.MapSlice, 0) //method without declaration such as 'get:'
+	}
+	parameters = withArguments(parameters, map[string]interface{}{paramMethodName: methodName})
+	traits := append(toList(mapSliceToMap(method)[fIs]), inherited...)
+	result := make(yaml.MapSlice, 0, len(method))
+	for _, item := range method {
+		if item.Key != fIs {
+			result = append(result, item)
+		}
+	}
+	//declaration of the method has priority over traits, the first trait has priority over the next ones
+	for _, reference := range traits {
+		if name, arguments, err := templateReference(reference); err != nil {
+			return nil, err
+		} else if trait, ok := self.traits[name]; !ok {
+			return nil, errors.New(fmt.Sprintf("Trait %s is not declared", name))
+		} else if trait, err := substitute(trait, withArguments(parameters, arguments)); err != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to apply trait %s. Error: %s", name, err.Error()))
+		} else {
+			result = mergeTrees(trait, result).(yaml.MapSlice)
+		}
+	}
+	return result, nil
+}
+
+func withArguments(parameters map[string]interface{}, arguments map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(parameters) + len(arguments))
+	for name, value := range parameters {
+		result[name] = value
+	}
+	for name, value := range arguments {
+		result[name] = value
+	}
+	return result
+}
+
+//merges resource type with resource. Optional method of resource type such as 'post?' is applied only if resource declares it
+func mergeResource(resourceType yaml.MapSlice, resource yaml.MapSlice) yaml.MapSlice {
+	declared := mapSliceToMap(resource)
+	base := make(yaml.MapSlice, 0, len(resourceType))
+	for _, item := range resourceType {
+		if name, ok := item.Key.(string); ok && strings.HasSuffix(name, "?") && isResourceMethod(strings.TrimSuffix(name, "?")) {
+			if _, ok := declared[strings.TrimSuffix(name, "?")]; !ok {
+				continue
+			}
+			item.Key = strings.TrimSuffix(name, "?")
+		} else if item.Key == fType {
+			continue
+		}
+		base = append(base, item)
+	}
+	result := mergeTrees(base, resource).(yaml.MapSlice)
+	//traits of resource type and resource are combined
+	if traits := append(toList(declared[fIs]), toList(mapSliceToMap(resourceType)[fIs])...); len(traits) > 0 {
+		for index, item := range result {
+			if item.Key == fIs {
+				result[index].Value = traits
+			}
+		}
+	}
+	return result
+}
+
+//converts tree into map including non-string keys such as status codes of responses
+func keyedMap(tree yaml.MapSlice) map[string]interface{} {
+	result := make(map[string]interface{}, len(tree))
+	for _, item := range tree {
+		result[fmt.Sprint(item.Key)] = item.Value
+	}
+	return result
+}
+
+//merges two trees. Values of the override tree have priority, maps are merged recursively
+func mergeTrees(base interface{}, override interface{}) interface{} {
+	baseMap, ok := base.(yaml.MapSlice)
+	if !ok {
+		return override
+	}
+	overrideMap, ok := override.(yaml.MapSlice)
+	if !ok {
+		if override == nil {
+			return base
+		}
+		return override
+	}
+	overridden := keyedMap(overrideMap)
+	result := make(yaml.MapSlice, 0, len(baseMap) + len(overrideMap))
+	for _, item := range baseMap {
+		if value, ok := overridden[fmt.Sprint(item.Key)]; ok {
+			item.Value = mergeTrees(item.Value, value)
+		}
+		result = append(result, item)
+	}
+	merged := keyedMap(baseMap)
+	for _, item := range overrideMap {
+		if _, ok := merged[fmt.Sprint(item.Key)]; !ok {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+//replaces parameters such as '<<resourcePathName>>' in keys and values of the tree
+func substitute(tree interface{}, parameters map[string]interface{}) (interface{}, error) {
+	switch tree := tree.(type) {
+	case string:
+		return substituteString(tree, parameters)
+	case yaml.MapSlice:
+		result := make(yaml.MapSlice, len(tree))
+		for index, item := range tree {
+			if key, err := substitute(item.Key, parameters); err != nil {
+				return nil, err
+			} else if value, err := substitute(item.Value, parameters); err != nil {
+				return nil, err
+			} else {
+				result[index] = yaml.MapItem{Key: key, Value: value}
+			}
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(tree))
+		for index, item := range tree {
+			if item, err := substitute(item, parameters); err == nil {
+				result[index] = item
+			} else {
+				return nil, err
+			}
+		}
+		return result, nil
+	default:
+		return tree, nil
+	}
+}
+
+func substituteString(value string, parameters map[string]interface{}) (interface{}, error) {
+	//value which consists of single parameter keeps type of the argument
+	if match := templateParamPattern.FindStringSubmatch(value); match != nil && match[0] == value && len(match[2]) == 0 {
+		if argument, ok := parameters[match[1]]; ok {
+			return argument, nil
+		} else {
+			return nil, errors.New(fmt.Sprintf("Parameter %s is not specified", match[1]))
+		}
+	}
+	var err error
+	result := templateParamPattern.ReplaceAllStringFunc(value, func(parameter string) string {
+		match := templateParamPattern.FindStringSubmatch(parameter)
+		argument, ok := parameters[match[1]]
+		if !ok {
+			err = errors.New(fmt.Sprintf("Parameter %s is not specified", match[1]))
+			return parameter
+		}
+		result := fmt.Sprint(argument)
+		for _, function := range templateFunctionPattern.FindAllString(match[2], -1) {
+			if transformed, e := transform(function, result); e == nil {
+				result = transformed
+			} else {
+				err = e
+			}
+		}
+		return result
+	})
+	return result, err
+}
+
+//applies function of resource type or trait parameter such as '!singularize'
+func transform(function string, value string) (string, error) {
+	switch function {
+	case "!singularize":
+		return singularize(value), nil
+	case "!pluralize":
+		return pluralize(value), nil
+	case "!uppercase":
+		return strings.ToUpper(value), nil
+	case "!lowercase":
+		return strings.ToLower(value), nil
+	case "!lowercamelcase":
+		return joinWords(splitWords(value), "", false, true), nil
+	case "!uppercamelcase":
+		return joinWords(splitWords(value), "", true, true), nil
+	case "!lowerunderscorecase":
+		return joinWords(splitWords(value), "_", false, false), nil
+	case "!upperunderscorecase":
+		return joinWords(splitWords(value), "_", true, false), nil
+	case "!lowerhyphencase":
+		return joinWords(splitWords(value), "-", false, false), nil
+	case "!upperhyphencase":
+		return joinWords(splitWords(value), "-", true, false), nil
+	default:
+		return "", errors.New(fmt.Sprintf("Unsupported function %s", function))
+	}
+}
+
+func singularize(word string) string {
+	switch lower := strings.ToLower(word); {
+	case strings.HasSuffix(lower, "ies") && len(word) > 3:
+		return word[:len(word) - 3] + "y"
+	case strings.HasSuffix(lower, "sses"), strings.HasSuffix(lower, "shes"), strings.HasSuffix(lower, "ches"), strings.HasSuffix(lower, "xes"), strings.HasSuffix(lower, "zes"):
+		return word[:len(word) - 2]
+	case strings.HasSuffix(lower, "s") && !strings.HasSuffix(lower, "ss"):
+		return word[:len(word) - 1]
+	default:
+		return word
+	}
+}
+
+func pluralize(word string) string {
+	switch lower := strings.ToLower(word); {
+	case strings.HasSuffix(lower, "y") && len(word) > 1 && !strings.ContainsAny(lower[len(lower) - 2:len(lower) - 1], "aeiou"):
+		return word[:len(word) - 1] + "ies"
+	case strings.HasSuffix(lower, "s"), strings.HasSuffix(lower, "sh"), strings.HasSuffix(lower, "ch"), strings.HasSuffix(lower, "x"), strings.HasSuffix(lower, "z"):
+		return word + "es"
+	default:
+		return word + "s"
+	}
+}
+
+//splits identifier such as 'userId', 'user_id' or 'user-id' into words
+func splitWords(value string) []string {
+	words := make([]string, 0)
+	word := make([]rune, 0)
+	for _, char := range value {
+		switch {
+		case !unicode.IsLetter(char) && !unicode.IsDigit(char):
+			if len(word) > 0 {
+				words = append(words, string(word))
+				word = word[:0]
+			}
+		case unicode.IsUpper(char) && len(word) > 0 && !unicode.IsUpper(word[len(word) - 1]):
+			words = append(words, string(word))
+			word = append(word[:0], char)
+		default:
+			word = append(word, char)
+		}
+	}
+	if len(word) > 0 {
+		words = append(words, string(word))
+	}
+	return words
+}
+
+func joinWords(words []string, separator string, upper bool, camel bool) string {
+	for index, word := range words {
+		switch {
+		case camel && (index > 0 || upper):
+			words[index] = strings.ToUpper(word[:1]) + strings.ToLower(word[1:])
+		case upper && !camel:
+			words[index] = strings.ToUpper(word)
+		default:
+			words[index] = strings.ToLower(word)
+		}
+	}
+	return strings.Join(words, separator)
+}
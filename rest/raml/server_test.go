@@ -5,7 +5,14 @@ import (
 	"github.com/sakno/go2rest/rest"
 	"net/http"
 	"io/ioutil"
-	_ "time"
+	"encoding/json"
+	"time"
+	"strings"
+	"archive/tar"
+	"io"
+	"bytes"
+	"mime/multipart"
+	"net/url"
 )
 
 const(
@@ -34,6 +41,554 @@ func TestServer(test *testing.T) {
 	} else {
 		test.Fatalf("Failed to GET. Error: %s", err.Error())
 	}
-	//time.Sleep(time.Hour)
 	server.Shutdown(nil)
-}
\ No newline at end of file
+}
+
+//starts server hosting model from the specified file
+func runServer(fileName string, test *testing.T) *rest.StandaloneServer {
+	model := new(Model)
+	if err := model.ReadModelFromFile(fileName); err != nil {
+		test.Fatal(err)
+	}
+	//connections to previously started server are not valid anymore
+	http.DefaultClient.CloseIdleConnections()
+	server := &rest.StandaloneServer{Model: model, OpenAPIPath: "/openapi.json"}
+	server.Addr = serverPort
+	if err := server.Run(true); err != nil {
+		test.Fatal(err)
+	}
+	return server
+}
+
+func TestOpenAPIRoute(test *testing.T) {
+	server := runServer("server-api.raml", test)
+	defer server.Close()
+	if response, err := http.Get(serverAddress + "/openapi.json"); err == nil {
+		defer response.Body.Close()
+		document := make(map[string]interface{})
+		if err := json.NewDecoder(response.Body).Decode(&document); err != nil {
+			test.Fatal(err)
+		}
+		paths := document["paths"].(map[string]interface{})
+		if endpoint, ok := paths["/echo1/{message}"].(map[string]interface{}); !ok {
+			test.Fatal("Endpoint is not exported")
+		} else if _, ok := endpoint["get"]; !ok {
+			test.Fatal("GET method is not exported")
+		} else if _, ok := endpoint["post"]; ok {
+			test.Fatal("POST method is not declared in the model")
+		}
+	} else {
+		test.Fatalf("Failed to GET. Error: %s", err.Error())
+	}
+}
+
+func TestStreaming(test *testing.T) {
+	server := runServer("server-api.raml", test)
+	defer server.Close()
+	if response, err := http.Get(serverAddress + "/stream/bla_bla"); err == nil {
+		defer response.Body.Close()
+		if message, err := ioutil.ReadAll(response.Body); err != nil || string(message) != "bla_bla\n" {
+			test.Fatalf("Unexpected result: %s", message)
+		}
+		if len(response.TransferEncoding) == 0 || response.TransferEncoding[0] != "chunked" {
+			test.Fatalf("Unexpected transfer encoding %v", response.TransferEncoding)
+		}
+		if exitCode := response.Trailer.Get("X-Exit-Code"); exitCode != "0" {
+			test.Fatalf("Unexpected exit code %s", exitCode)
+		}
+	} else {
+		test.Fatalf("Failed to GET. Error: %s", err.Error())
+	}
+	//status code is sent before execution so failure is reported in trailer only
+	if response, err := http.Get(serverAddress + "/exit/3"); err == nil {
+		defer response.Body.Close()
+		ioutil.ReadAll(response.Body)
+		if response.StatusCode != http.StatusOK {
+			test.Fatalf("Unexpected status code %v", response.StatusCode)
+		}
+		if exitCode := response.Trailer.Get("X-Exit-Code"); exitCode != "3" {
+			test.Fatalf("Unexpected exit code %s", exitCode)
+		}
+	} else {
+		test.Fatalf("Failed to GET. Error: %s", err.Error())
+	}
+	//only the tail of large stderr is reported
+	if response, err := http.Get(serverAddress + "/noisy"); err == nil {
+		defer response.Body.Close()
+		ioutil.ReadAll(response.Body)
+		if message := response.Trailer.Get("X-Error"); !strings.HasPrefix(message, "Command sh at stage 0 exited with code 5: ...") || len(message) > 512 {
+			test.Fatalf("Unexpected error %s", message)
+		}
+	} else {
+		test.Fatalf("Failed to GET. Error: %s", err.Error())
+	}
+}
+
+func TestServerSentEvents(test *testing.T) {
+	server := runServer("server-api.raml", test)
+	defer server.Close()
+	if response, err := http.Get(serverAddress + "/events"); err == nil {
+		defer response.Body.Close()
+		const expected = "data: one\n\ndata: two\n\nevent: exit\ndata: {\"exitCode\":0}\n\n"
+		if message, err := ioutil.ReadAll(response.Body); err != nil || string(message) != expected {
+			test.Fatalf("Unexpected result: %s", message)
+		}
+	} else {
+		test.Fatalf("Failed to GET. Error: %s", err.Error())
+	}
+}
+
+func TestNDJSON(test *testing.T) {
+	server := runServer("server-api.raml", test)
+	defer server.Close()
+	if response, err := http.Get(serverAddress + "/records"); err == nil {
+		defer response.Body.Close()
+		decoder := json.NewDecoder(response.Body)
+		records := make([]map[string]interface{}, 0)
+		for decoder.More() {
+			record := make(map[string]interface{})
+			if err := decoder.Decode(&record); err != nil {
+				test.Fatal(err)
+			}
+			records = append(records, record)
+		}
+		if len(records) != 3 || records[1]["data"] != "two" || records[2]["type"] != "exit" || records[2]["exitCode"] != 0.0 {
+			test.Fatalf("Unexpected records %v", records)
+		}
+	} else {
+		test.Fatalf("Failed to GET. Error: %s", err.Error())
+	}
+}
+
+func readJobStatus(response *http.Response, test *testing.T) map[string]interface{} {
+	defer response.Body.Close()
+	status := make(map[string]interface{})
+	if err := json.NewDecoder(response.Body).Decode(&status); err != nil {
+		test.Fatal(err)
+	}
+	return status
+}
+
+func TestAsyncJob(test *testing.T) {
+	server := runServer("server-api.raml", test)
+	defer server.Close()
+	response, err := http.Get(serverAddress + "/async/bla_bla")
+	if err != nil {
+		test.Fatalf("Failed to GET. Error: %s", err.Error())
+	} else if response.StatusCode != http.StatusAccepted {
+		test.Fatalf("Unexpected status code %v", response.StatusCode)
+	}
+	location := serverAddress + response.Header.Get("Location")
+	status := readJobStatus(response, test)
+	//wait for completion
+	for deadline := time.Now().Add(5 * time.Second); status["status"] == "running"; {
+		if time.Now().After(deadline) {
+			test.Fatal("Job is not completed in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+		if response, err := http.Get(location); err == nil {
+			status = readJobStatus(response, test)
+		} else {
+			test.Fatal(err)
+		}
+	}
+	if status["status"] != "succeeded" || status["exitCode"] != 0.0 {
+		test.Fatalf("Unexpected job status %v", status)
+	}
+	if response, err := http.Get(location + "/stdout"); err == nil {
+		defer response.Body.Close()
+		if message, err := ioutil.ReadAll(response.Body); err != nil || string(message) != "bla_bla\n" {
+			test.Fatalf("Unexpected result: %s", message)
+		}
+	} else {
+		test.Fatal(err)
+	}
+	//remove completed job
+	request, _ := http.NewRequest(http.MethodDelete, location, nil)
+	if response, err := http.DefaultClient.Do(request); err != nil || response.StatusCode != http.StatusNoContent {
+		test.Fatalf("Failed to remove job: %v", err)
+	}
+	if response, err := http.Get(location); err != nil || response.StatusCode != http.StatusNotFound {
+		test.Fatal("Job is not removed")
+	}
+}
+
+func TestAsyncJobLimit(test *testing.T) {
+	maxJobs := rest.MaxJobs
+	rest.MaxJobs = 1
+	defer func() { rest.MaxJobs = maxJobs }()
+	server := runServer("server-api.raml", test)
+	defer server.Close()
+	response, err := http.Get(serverAddress + "/async/first")
+	if err != nil {
+		test.Fatalf("Failed to GET. Error: %s", err.Error())
+	} else if response.StatusCode != http.StatusAccepted {
+		test.Fatalf("Unexpected status code %v", response.StatusCode)
+	}
+	location := serverAddress + response.Header.Get("Location")
+	readJobStatus(response, test)
+	//completed job still occupies the slot
+	if response, err := http.Get(serverAddress + "/async/second"); err != nil || response.StatusCode != http.StatusServiceUnavailable {
+		test.Fatalf("Job limit is not applied: %v", err)
+	}
+	//running job is cancelled by the first request and removed by the next one
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			test.Fatal("Job is not removed in time")
+		}
+		request, _ := http.NewRequest(http.MethodDelete, location, nil)
+		if response, err := http.DefaultClient.Do(request); err != nil {
+			test.Fatal(err)
+		} else if response.StatusCode == http.StatusNotFound {
+			break
+		}
+	}
+	if response, err := http.Get(serverAddress + "/async/third"); err != nil || response.StatusCode != http.StatusAccepted {
+		test.Fatalf("Slot of removed job is not released: %v", err)
+	}
+}
+
+func TestAsyncJobCancellation(test *testing.T) {
+	server := runServer("server-api.raml", test)
+	defer server.Close()
+	response, err := http.Get(serverAddress + "/sleep")
+	if err != nil {
+		test.Fatalf("Failed to GET. Error: %s", err.Error())
+	}
+	response.Body.Close()
+	request, _ := http.NewRequest(http.MethodDelete, serverAddress + response.Header.Get("Location"), nil)
+	if response, err := http.DefaultClient.Do(request); err == nil {
+		if status := readJobStatus(response, test); status["status"] != "cancelled" {
+			test.Fatalf("Unexpected job status %v", status)
+		}
+	} else {
+		test.Fatal(err)
+	}
+}
+
+func TestErrorDetails(test *testing.T) {
+	server := runServer("server-api.raml", test)
+	defer server.Close()
+	if response, err := http.Get(serverAddress + "/fail"); err == nil {
+		defer response.Body.Close()
+		if response.StatusCode != http.StatusUnprocessableEntity {
+			test.Fatalf("Unexpected status code %v", response.StatusCode)
+		}
+		details := make(map[string]interface{})
+		if err := json.NewDecoder(response.Body).Decode(&details); err != nil {
+			test.Fatal(err)
+		}
+		if details["exitCode"] != 3.0 || details["stderr"] != "oops\n" || details["command"] != "sh" {
+			test.Fatalf("Unexpected error details %v", details)
+		}
+	} else {
+		test.Fatalf("Failed to GET. Error: %s", err.Error())
+	}
+}
+
+func TestProblemDetails(test *testing.T) {
+	server := runServer("server-api.raml", test)
+	defer server.Close()
+	request, _ := http.NewRequest(http.MethodGet, serverAddress + "/exit/abc", nil)
+	request.Header.Set("Accept", "application/problem+json")
+	if response, err := http.DefaultClient.Do(request); err == nil {
+		defer response.Body.Close()
+		if response.StatusCode != http.StatusBadRequest {
+			test.Fatalf("Unexpected status code %v", response.StatusCode)
+		} else if contentType := response.Header.Get("Content-Type"); contentType != "application/problem+json" {
+			test.Fatalf("Unexpected content type %s", contentType)
+		}
+		details := make(map[string]interface{})
+		if err := json.NewDecoder(response.Body).Decode(&details); err != nil {
+			test.Fatal(err)
+		} else if details["status"] != float64(http.StatusBadRequest) || details["parameter"] != "code" {
+			test.Fatalf("Unexpected problem details %v", details)
+		}
+	} else {
+		test.Fatalf("Failed to GET. Error: %s", err.Error())
+	}
+	//plain text is returned by default
+	if response, err := http.Get(serverAddress + "/exit/abc"); err == nil {
+		defer response.Body.Close()
+		if contentType := response.Header.Get("Content-Type"); contentType != "text/plain; charset=utf-8" {
+			test.Fatalf("Unexpected content type %s", contentType)
+		}
+	} else {
+		test.Fatalf("Failed to GET. Error: %s", err.Error())
+	}
+}
+
+func TestArgvCommand(test *testing.T) {
+	server := runServer("server-api.raml", test)
+	defer server.Close()
+	if response, err := http.Get(serverAddress + "/argv/one%20%22two%22"); err == nil {
+		defer response.Body.Close()
+		if message, err := ioutil.ReadAll(response.Body); err != nil {
+			test.Fatal(err)
+		} else if message := string(message); message != "one \"two\"|" {
+			test.Fatalf("Unexpected result: %s", message)
+		}
+	} else {
+		test.Fatalf("Failed to GET. Error: %s", err.Error())
+	}
+}
+
+func TestStdin(test *testing.T) {
+	server := runServer("server-api.raml", test)
+	defer server.Close()
+	if response, err := http.Post(serverAddress + "/sort", "text/plain", strings.NewReader("b\nc\na\n")); err == nil {
+		defer response.Body.Close()
+		if message, err := ioutil.ReadAll(response.Body); err != nil {
+			test.Fatal(err)
+		} else if message := string(message); message != "a\nb\nc\n" {
+			test.Fatalf("Unexpected result: %s", message)
+		}
+	} else {
+		test.Fatalf("Failed to POST. Error: %s", err.Error())
+	}
+}
+
+func TestPipeline(test *testing.T) {
+	server := runServer("server-api.raml", test)
+	defer server.Close()
+	if response, err := http.Get(serverAddress + "/count/one"); err == nil {
+		defer response.Body.Close()
+		if message, err := ioutil.ReadAll(response.Body); err != nil {
+			test.Fatal(err)
+		} else if message := string(message); message != "2\n" {
+			test.Fatalf("Unexpected result: %s", message)
+		}
+	} else {
+		test.Fatalf("Failed to GET. Error: %s", err.Error())
+	}
+	//grep is failed when nothing is found
+	request, _ := http.NewRequest(http.MethodGet, serverAddress + "/count/three", nil)
+	request.Header.Set("Accept", "application/problem+json")
+	if response, err := http.DefaultClient.Do(request); err == nil {
+		defer response.Body.Close()
+		details := make(map[string]interface{})
+		if err := json.NewDecoder(response.Body).Decode(&details); err != nil {
+			test.Fatal(err)
+		} else if details["exitCode"] != float64(1) || details["stage"] != float64(1) {
+			test.Fatalf("Unexpected problem details %v", details)
+		}
+	} else {
+		test.Fatalf("Failed to GET. Error: %s", err.Error())
+	}
+}
+
+func TestEnvironment(test *testing.T) {
+	server := runServer("server-api.raml", test)
+	defer server.Close()
+	if response, err := http.Get(serverAddress + "/env?greeting=hello"); err == nil {
+		defer response.Body.Close()
+		if message, err := ioutil.ReadAll(response.Body); err != nil {
+			test.Fatal(err)
+		} else if message := string(message); message != "hello\n" {
+			test.Fatalf("Unexpected result: %s", message)
+		}
+	} else {
+		test.Fatalf("Failed to GET. Error: %s", err.Error())
+	}
+}
+
+func TestSandbox(test *testing.T) {
+	server := runServer("server-api.raml", test)
+	defer server.Close()
+	if response, err := http.Get(serverAddress + "/sandbox"); err == nil {
+		defer response.Body.Close()
+		if message, err := ioutil.ReadAll(response.Body); err != nil {
+			test.Fatal(err)
+		} else if message := string(message); message != "output.txt\n" {
+			test.Fatalf("Unexpected result: %s", message)
+		}
+	} else {
+		test.Fatalf("Failed to GET. Error: %s", err.Error())
+	}
+}
+
+func TestOutputFile(test *testing.T) {
+	server := runServer("server-api.raml", test)
+	defer server.Close()
+	if response, err := http.Get(serverAddress + "/output"); err == nil {
+		defer response.Body.Close()
+		if message, err := ioutil.ReadAll(response.Body); err != nil {
+			test.Fatal(err)
+		} else if message := string(message); message != "converted\n" {
+			test.Fatalf("Unexpected result: %s", message)
+		}
+	} else {
+		test.Fatalf("Failed to GET. Error: %s", err.Error())
+	}
+}
+
+func TestOutputDirectory(test *testing.T) {
+	server := runServer("server-api.raml", test)
+	defer server.Close()
+	if response, err := http.Get(serverAddress + "/artifacts"); err == nil {
+		defer response.Body.Close()
+		names := make([]string, 0, 3)
+		archive := tar.NewReader(response.Body)
+		for header, err := archive.Next(); err != io.EOF; header, err = archive.Next() {
+			if err != nil {
+				test.Fatal(err)
+			}
+			names = append(names, header.Name)
+		}
+		if strings.Join(names, ",") != "bin,bin/app,build.log" {
+			test.Fatalf("Unexpected content of archive %v", names)
+		}
+	} else {
+		test.Fatalf("Failed to GET. Error: %s", err.Error())
+	}
+}
+
+func TestMultipartForm(test *testing.T) {
+	server := runServer("server-api.raml", test)
+	defer server.Close()
+	body := new(bytes.Buffer)
+	form := multipart.NewWriter(body)
+	if part, err := form.CreateFormFile("first", "first.txt"); err == nil {
+		part.Write([]byte("one\n"))
+	}
+	if part, err := form.CreateFormFile("second", "second.txt"); err == nil {
+		part.Write([]byte("two\n"))
+	}
+	form.WriteField("separator", "+")
+	form.Close()
+	//form field has priority over query parameter with the same name
+	if response, err := http.Post(serverAddress + "/concat?separator=*", form.FormDataContentType(), body); err == nil {
+		defer response.Body.Close()
+		if message, err := ioutil.ReadAll(response.Body); err != nil {
+			test.Fatal(err)
+		} else if message := string(message); message != "one\n+\ntwo\n" {
+			test.Fatalf("Unexpected result: %s", message)
+		}
+	} else {
+		test.Fatalf("Failed to POST. Error: %s", err.Error())
+	}
+	//the same field cannot be specified twice
+	body.Reset()
+	form = multipart.NewWriter(body)
+	form.WriteField("separator", "+")
+	form.WriteField("separator", "-")
+	form.Close()
+	if response, err := http.Post(serverAddress + "/concat", form.FormDataContentType(), body); err == nil {
+		response.Body.Close()
+		if response.StatusCode != http.StatusBadRequest {
+			test.Fatalf("Unexpected status code %v", response.StatusCode)
+		}
+	} else {
+		test.Fatalf("Failed to POST. Error: %s", err.Error())
+	}
+}
+
+func TestURLEncodedForm(test *testing.T) {
+	server := runServer("server-api.raml", test)
+	defer server.Close()
+	if response, err := http.PostForm(serverAddress + "/greet", url.Values{"name": {"world"}}); err == nil {
+		defer response.Body.Close()
+		if message, err := ioutil.ReadAll(response.Body); err != nil {
+			test.Fatal(err)
+		} else if message := string(message); message != "Hello, world!" {
+			test.Fatalf("Unexpected result: %s", message)
+		}
+	} else {
+		test.Fatalf("Failed to POST. Error: %s", err.Error())
+	}
+	//field is validated according with its declaration
+	if response, err := http.PostForm(serverAddress + "/greet", url.Values{"name": {"World 1"}}); err == nil {
+		response.Body.Close()
+		if response.StatusCode != http.StatusBadRequest {
+			test.Fatalf("Unexpected status code %v", response.StatusCode)
+		}
+	} else {
+		test.Fatalf("Failed to POST. Error: %s", err.Error())
+	}
+}
+
+func TestObjectBody(test *testing.T) {
+	server := runServer("server-api.raml", test)
+	defer server.Close()
+	person := `{"name": "Alice", "age": 30, "skills": [{"title": "go", "level": 5}, {"title": "sql"}]}`
+	if response, err := http.Post(serverAddress + "/person", "application/json", strings.NewReader(person)); err == nil {
+		defer response.Body.Close()
+		if message, err := ioutil.ReadAll(response.Body); err != nil {
+			test.Fatal(err)
+		} else if message := string(message); message != "Alice has 2 skills" {
+			test.Fatalf("Unexpected result: %s", message)
+		}
+	} else {
+		test.Fatalf("Failed to POST. Error: %s", err.Error())
+	}
+	//undeclared field, missing required field of nested object, wrong type of field
+	for _, person := range []string{`{"name": "Bob", "skills": [], "email": "bob@example.com"}`, `{"name": "Bob", "skills": [{"level": 1}]}`, `{"name": "Bob", "age": "old", "skills": []}`} {
+		if response, err := http.Post(serverAddress + "/person", "application/json", strings.NewReader(person)); err == nil {
+			response.Body.Close()
+			if response.StatusCode != http.StatusBadRequest {
+				test.Fatalf("Unexpected status code %v for %s", response.StatusCode, person)
+			}
+		} else {
+			test.Fatalf("Failed to POST. Error: %s", err.Error())
+		}
+	}
+}
+
+func TestNestedResource(test *testing.T) {
+	server := runServer("server-api.raml", test)
+	defer server.Close()
+	if response, err := http.Get(serverAddress + "/users/alice/keys/42"); err == nil {
+		defer response.Body.Close()
+		if message, err := ioutil.ReadAll(response.Body); err != nil {
+			test.Fatal(err)
+		} else if message := string(message); message != "alice:42" {
+			test.Fatalf("Unexpected result: %s", message)
+		}
+	} else {
+		test.Fatalf("Failed to GET. Error: %s", err.Error())
+	}
+	//URI parameter of parent resource is validated
+	if response, err := http.Get(serverAddress + "/users/Alice/keys/42"); err == nil {
+		response.Body.Close()
+		if response.StatusCode != http.StatusBadRequest {
+			test.Fatalf("Unexpected status code %v", response.StatusCode)
+		}
+	} else {
+		test.Fatalf("Failed to GET. Error: %s", err.Error())
+	}
+	//resource without methods is not registered
+	if response, err := http.Get(serverAddress + "/users/alice"); err == nil {
+		response.Body.Close()
+		if response.StatusCode != http.StatusNotFound {
+			test.Fatalf("Unexpected status code %v", response.StatusCode)
+		}
+	} else {
+		test.Fatalf("Failed to GET. Error: %s", err.Error())
+	}
+}
+
+func TestResourceType(test *testing.T) {
+	server := runServer("server-api.raml", test)
+	defer server.Close()
+	for query, expected := range map[string]string{"": "book 1 of books", "?page=2": "book 2 of books"} {
+		if response, err := http.Get(serverAddress + "/books" + query); err == nil {
+			defer response.Body.Close()
+			if message, err := ioutil.ReadAll(response.Body); err != nil {
+				test.Fatal(err)
+			} else if message := string(message); message != expected {
+				test.Fatalf("Unexpected result: %s", message)
+			}
+		} else {
+			test.Fatalf("Failed to GET. Error: %s", err.Error())
+		}
+	}
+	//optional method of resource type is not declared by resource
+	if response, err := http.Post(serverAddress + "/books", "text/plain", strings.NewReader("")); err == nil {
+		response.Body.Close()
+		if response.StatusCode != http.StatusMethodNotAllowed {
+			test.Fatalf("Unexpected status code %v", response.StatusCode)
+		}
+	} else {
+		test.Fatalf("Failed to POST. Error: %s", err.Error())
+	}
+}
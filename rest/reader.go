@@ -0,0 +1,249 @@
+package rest
+
+import (
+	"github.com/sakno/go2rest/cmdexec"
+	"time"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"path/filepath"
+	"strings"
+)
+
+//Helpers shared by readers of model formats such as RAML and OpenAPI
+
+const (
+	//special exit code of the process killed because of expired timeout
+	exitCodeTimeout = "timeout"
+	//working directory created for each request
+	workingDirectoryAuto = "auto"
+)
+
+//Parses timeout expressed as duration string or number of seconds. Zero means no timeout
+func ParseTimeout(value interface{}) (time.Duration, error) {
+	var timeout time.Duration
+	switch value := value.(type) {
+	case string:
+		if duration, err := time.ParseDuration(value); err == nil {
+			timeout = duration
+		} else {
+			return 0, err
+		}
+	case int:
+		timeout = time.Duration(value) * time.Second
+	default:
+		return 0, errors.New(fmt.Sprintf("Failed to parse timeout: %v", value))
+	}
+	if timeout < 0 {
+		return 0, errors.New(fmt.Sprintf("Timeout can't be negative: %v", value))
+	}
+	return timeout, nil
+}
+
+//Parses exit code which can be expressed as integer or special keyword 'timeout'
+func ParseExitCode(value interface{}) (int, bool) {
+	switch value {
+	case exitCodeTimeout:
+		return cmdexec.ExitCodeTimeout, true
+	default:
+		exitCode, ok := value.(int)
+		return exitCode, ok
+	}
+}
+
+//Names of model fields which describe command-line tool. Each model format uses its own names
+type CommandFields struct {
+	Command string	//list of arguments
+	CommandPattern string	//template of command line
+	Pipeline string	//list of commands connected by pipes
+	Environment string	//map of environment variables
+	InheritEnvironment string	//list of environment variables inherited from the server process
+	WorkingDirectory string	//working directory of each command
+}
+
+//Creates command renderer from template string or list of argument templates
+func ParseStage(stage interface{}) (cmdexec.CommandRenderer, error) {
+	switch stage := stage.(type) {
+	case string:
+		if renderer, err := cmdexec.NewAutoNamedRenderer(stage); err == nil {
+			return renderer, nil
+		} else {
+			return nil, errors.New(fmt.Sprintf("Failed to parse command pattern %s. Error %s", stage, err.Error()))
+		}
+	case []interface{}:
+		argv := make([]string, len(stage))
+		for index, arg := range stage {
+			argv[index] = fmt.Sprint(arg)
+		}
+		if renderer, err := cmdexec.NewArgvRenderer(argv); err == nil {
+			return renderer, nil
+		} else {
+			return nil, errors.New(fmt.Sprintf("Failed to parse command %v. Error %s", argv, err.Error()))
+		}
+	default:
+		return nil, errors.New(fmt.Sprintf("Invalid format of command %v", stage))
+	}
+}
+
+//Creates pipeline of command renderers from command list, command pattern string or pipeline list
+func (self CommandFields) ParsePipeline(tree map[string]interface{}) ([]cmdexec.CommandRenderer, error) {
+	command, hasCommand := tree[self.Command]
+	commandPattern, hasPattern := tree[self.CommandPattern]
+	pipeline, hasPipeline := tree[self.Pipeline]
+	switch {
+	case hasCommand && hasPattern, hasCommand && hasPipeline, hasPattern && hasPipeline:
+		return nil, errors.New(fmt.Sprintf("Only one of %s, %s or %s can be specified", self.Command, self.CommandPattern, self.Pipeline))
+	case hasPipeline:
+		if pipeline, ok := pipeline.([]interface{}); !ok || len(pipeline) == 0 {
+			return nil, errors.New("Pipeline should be a non-empty list of commands")
+		} else {
+			result := make([]cmdexec.CommandRenderer, len(pipeline))
+			for index, stage := range pipeline {
+				if renderer, err := ParseStage(stage); err == nil {
+					result[index] = renderer
+				} else {
+					return nil, err
+				}
+			}
+			return result, nil
+		}
+	case hasCommand:
+		if _, ok := command.([]interface{}); !ok {
+			return nil, errors.New("Command should be a list of arguments")
+		} else if renderer, err := ParseStage(command); err == nil {
+			return []cmdexec.CommandRenderer{renderer}, nil
+		} else {
+			return nil, err
+		}
+	case hasPattern:
+		if _, ok := commandPattern.(string); !ok {
+			return nil, errors.New("Invalid format of command pattern")
+		} else if renderer, err := ParseStage(commandPattern); err == nil {
+			return []cmdexec.CommandRenderer{renderer}, nil
+		} else {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("Command pattern is not specified")
+	}
+}
+
+//Passes environment variables declared by environment map and inherited environment list to each command of the pipeline
+func (self CommandFields) ParseEnvironment(tree map[string]interface{}, pipeline []cmdexec.CommandRenderer) error {
+	environment, hasEnvironment := tree[self.Environment]
+	inherit, hasInherit := tree[self.InheritEnvironment]
+	if !hasEnvironment && !hasInherit {
+		return nil
+	}
+	variables := make(map[string]string)
+	if hasEnvironment {
+		if environment, ok := environment.(yaml.MapSlice); ok {
+			for _, variable := range environment {
+				variables[fmt.Sprint(variable.Key)] = fmt.Sprint(variable.Value)
+			}
+		} else {
+			return errors.New("Environment should be a map of variables")
+		}
+	}
+	var inheritedVariables []string
+	if hasInherit {
+		if inherit, ok := inherit.([]interface{}); ok {
+			inheritedVariables = make([]string, len(inherit))
+			for index, name := range inherit {
+				inheritedVariables[index] = fmt.Sprint(name)
+			}
+		} else {
+			return errors.New("List of inherited environment variables is expected")
+		}
+	}
+	for index, renderer := range pipeline {
+		if renderer, err := cmdexec.NewEnvironmentRenderer(renderer, variables, inheritedVariables); err == nil {
+			pipeline[index] = renderer
+		} else {
+			return errors.New(fmt.Sprintf("Failed to parse environment variables. Error %s", err.Error()))
+		}
+	}
+	return nil
+}
+
+//Runs each command of the pipeline in the declared working directory.
+//Special value 'auto' means temporary directory created for each request
+func (self CommandFields) ParseWorkingDirectory(tree map[string]interface{}, pipeline []cmdexec.CommandRenderer, options map[string]bool) error {
+	directory, ok := tree[self.WorkingDirectory]
+	if !ok {
+		return nil
+	} else if directory, ok := directory.(string); !ok {
+		return errors.New("Working directory should be a string")
+	} else {
+		if directory == workingDirectoryAuto {
+			options[OptionSandbox] = true
+			directory = "{{." + TemplateParamWorkdir + "}}"
+		}
+		for index, renderer := range pipeline {
+			if renderer, err := cmdexec.NewWorkingDirectoryRenderer(renderer, directory); err == nil {
+				pipeline[index] = renderer
+			} else {
+				return errors.New(fmt.Sprintf("Failed to parse working directory %s. Error %s", directory, err.Error()))
+			}
+		}
+		return nil
+	}
+}
+
+//arguments passed to command template by the server itself
+var reservedArguments = []string{TemplateParamBody, TemplateParamWorkdir, TemplateParamOutput}
+
+//Checks that fields of the form body can be passed to command template as separate arguments.
+//Fields can't replace arguments provided by the server, urlencoded form can't transfer files
+func ValidateRequestBody(mimeType string, body Parameter) error {
+	object, ok := body.(ObjectParameter)
+	if !ok || mimeType != mimeMultipart && mimeType != mimeURLEncoded {
+		return nil
+	}
+	for name, field := range object.Fields() {
+		for _, reserved := range reservedArguments {
+			if name == reserved {
+				return errors.New(fmt.Sprintf("Form field %s conflicts with reserved argument of command template", name))
+			}
+		}
+		if _, ok := field.(FileParameter); ok && mimeType == mimeURLEncoded {
+			return errors.New(fmt.Sprintf("Form field %s can't be a file because %s body has no files", name, mimeType))
+		}
+	}
+	return nil
+}
+
+//Converts value of output file field into pattern of output file name.
+//Value is boolean flag or extension of the file. Extension can't point outside of the temporary directory
+func ParseOutputFile(value interface{}) (string, bool) {
+	switch value := value.(type) {
+	case nil: //stdout is used as response body
+		return "", true
+	case bool:
+		if value {
+			return "*", true
+		} else {
+			return "", true
+		}
+	case string:
+		if filepath.IsAbs(value) || strings.ContainsAny(value, "/\\") || strings.Contains(value, "..") {
+			return "", false
+		}
+		return "*" + value, true
+	default:
+		return "", false
+	}
+}
+
+//Checks that output of the process can be used as response body
+func ValidateOutput(descriptor ResponseDescriptor) error {
+	if !descriptor.OutputDirectory {
+		return nil
+	} else if len(descriptor.OutputFile) > 0 {
+		return errors.New(fmt.Sprintf("Output file and output directory cannot be specified for status code %v at the same time", descriptor.StatusCode))
+	} else if _, ok := GetArchiveFormatByMIME(descriptor.MimeType); !ok {
+		return errors.New(fmt.Sprintf("Output directory for status code %v requires archive media type instead of %s", descriptor.StatusCode, descriptor.MimeType))
+	} else {
+		return nil
+	}
+}
@@ -11,15 +11,18 @@ import (
 	"strings"
 	"mime"
 	"io"
+	"io/ioutil"
 	"os"
-	"net/textproto"
 	"strconv"
 	"github.com/sakno/go2rest/core"
+	"net"
+	"encoding/json"
 )
 const (
 	headerContentType = "Content-Type"
 	headerContentLength = "Content-Length"
 	TemplateParamBody = "body"
+	TemplateParamWorkdir = "workdir"	//temporary working directory of the request
 )
 var wellKnownMethods = []string{http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete, http.MethodOptions, http.MethodHead, http.MethodPatch}
 
@@ -28,6 +31,8 @@ type requestContext struct {
 	*http.Request
 	args cmdexec.Arguments
 	deferredActions []core.DeferredAction
+	jobs *jobRegistry	//registry of asynchronous jobs, may be nil
+	stdin io.Reader	//input of the process, may be nil
 }
 
 func (self *requestContext) finalize() {
@@ -49,6 +54,7 @@ type StandaloneServer struct {
 	http.Server
 	CertFile, KeyFile string
 	Model Model
+	OpenAPIPath string	//path of built-in route with OpenAPI document. Empty string to disable the route
 }
 
 func setDefaultValue(name string, input Parameter, output cmdexec.Arguments) bool{
@@ -86,18 +92,15 @@ func (self *requestContext) parseArguments(parameters ParameterList, varResolver
 				if parameter.Validate(value) {
 					self.args[name] = value
 				} else {
-					return &textproto.Error{Msg: fmt.Sprintf("Argument %s has invalid value %v", name, value), Code: http.StatusBadRequest}
+					return newParameterProblem(name, http.StatusBadRequest, fmt.Sprintf("Argument %s has invalid value %v", name, value))
 				}
 			} else {
-				return err
+				return newParameterProblem(name, http.StatusBadRequest, fmt.Sprintf("Argument %s has invalid format. Error: %s", name, err.Error()))
 			}
 		} else if parameter.HasDefaultValue() { //parameter doesn't exist and not required
 			setDefaultValue(name, parameter, self.args)
 		} else if parameter.Required() {
-			return &textproto.Error{
-				Msg:  fmt.Sprintf("Parameter %s is required but not specified in actual request", name),
-				Code: http.StatusBadRequest,
-			}
+			return newParameterProblem(name, http.StatusBadRequest, fmt.Sprintf("Parameter %s is required but not specified in actual request", name))
 		}
 	}
 	return nil
@@ -117,7 +120,11 @@ func extractHeaders(request *http.Request) map[string]string {
 
 func (self *requestContext) parseRequestBody(bodyDefinition ParameterList, requestType string) error {
 	defer self.Body.Close()
-	if body, exists := bodyDefinition[requestType]; exists { //body for this MIME type is specified
+	if body, exists := bodyDefinition[requestType].(ObjectParameter); exists && requestType == mimeMultipart {
+		return self.parseMultipartForm(body)	//each part of the body is a separate argument
+	} else if exists && requestType == mimeURLEncoded {
+		return self.parseURLEncodedForm(body)	//each field of the form is a separate argument
+	} else if body, exists := bodyDefinition[requestType]; exists { //body for this MIME type is specified
 		if body, err := body.ReadValue(self.Body, GetFormatByMIME(requestType)); err == nil {
 			switch body := body.(type) {
 			case *os.File:
@@ -128,27 +135,84 @@ func (self *requestContext) parseRequestBody(bodyDefinition ParameterList, reque
 				self.Defer(func() { os.Remove(fileName) })	//ensure that temporary file with request body will be deleted
 				return nil
 			default:
+				//object is validated recursively, its fields are accessible from template as {{.body.name}}
+				if object, ok := bodyDefinition[requestType].(ObjectParameter); ok && !object.Validate(body) {
+					return newParameterProblem(TemplateParamBody, http.StatusBadRequest, fmt.Sprintf("Request body doesn't match to declaration of %s", requestType))
+				}
 				self.args[TemplateParamBody] = body
 				return nil
 			}
 		} else if err == io.EOF { //no body is present
-			return &textproto.Error{Msg: "Request body is empty", Code: http.StatusBadRequest}
+			return newParameterProblem(TemplateParamBody, http.StatusBadRequest, "Request body is empty")
 		} else { //failed to read body
 			return err
 		}
 	} else if len(bodyDefinition) == 0 { //model has no definition of the body. It's ok and just return without any error
 		return nil
 	} else { //media type is not configured in model
-		return &textproto.Error{Msg: fmt.Sprintf("Unsupported media type: %s", requestType), Code: http.StatusUnsupportedMediaType}
+		return newProblem(http.StatusUnsupportedMediaType, fmt.Sprintf("Unsupported media type: %s", requestType))
 	}
 }
 
-func convertToHttpError(err error, response http.ResponseWriter) {
-	switch err := err.(type) {
-	case *textproto.Error:
-		http.Error(response, err.Msg, err.Code)
-	default:
-		http.Error(response, err.Error(), http.StatusInternalServerError)
+//parses request body or passes it to stdin of the process
+func (self *requestContext) readRequestBody(descriptor HttpMethodDescriptor, requestType string) error {
+	bodyDefinition := descriptor.Request()
+	if !descriptor.HasOption(OptionStdin) {
+		return self.parseRequestBody(bodyDefinition, requestType)
+	} else if _, exists := bodyDefinition[requestType]; exists || len(bodyDefinition) == 0 {
+		self.stdin = self.Body	//body will be read by the process without intermediate buffer
+		return nil
+	} else {
+		return newProblem(http.StatusUnsupportedMediaType, fmt.Sprintf("Unsupported media type: %s", requestType))
+	}
+}
+
+//creates temporary working directory which is removed when the request is finished
+func (self *requestContext) createSandbox() error {
+	if directory, err := cmdexec.NewTempDir(); err == nil {
+		self.args[TemplateParamWorkdir] = directory
+		self.Defer(func() { os.RemoveAll(directory) })
+		return nil
+	} else {
+		return err
+	}
+}
+
+//allows to read request body after response headers are sent
+func (self *requestContext) enableFullDuplex(response http.ResponseWriter) {
+	if self.stdin == nil {
+		return
+	} else if err := http.NewResponseController(response).EnableFullDuplex(); err != nil {
+		log.Printf("Request body of %s %s may be unavailable after response headers. Error: %s", self.Method, self.URL, err.Error())
+	}
+}
+
+//structured description of failed execution
+type errorDetails struct {
+	ExitCode int `json:"exitCode"`
+	Stderr string `json:"stderr"`
+	Command string `json:"command"`
+	Stage int `json:"stage"`	//index of the failed command in the pipeline
+}
+
+func (self *requestContext) writeErrorDetails(err *cmdexec.ExecutionError, statusCode int, response http.ResponseWriter) {
+	if content, e := json.Marshal(&errorDetails{ExitCode: err.ProcessExitCode, Stderr: err.Stderr(), Command: err.Command, Stage: err.Stage}); e == nil {
+		response.Header().Set(headerContentType, "application/json")
+		response.Header().Set(headerContentLength, strconv.Itoa(len(content)))
+		response.WriteHeader(statusCode)
+		response.Write(content)
+	} else {
+		writeError(e, self.Request, response)
+	}
+}
+
+//selects buffer for output according with response type
+func newReceiver(successResponse ResponseDescriptor) (cmdexec.ExecutionResultRecorder, error) {
+	switch successResponse.Body.(type) {
+	case FileParameter: //for file response result should be saved into temporary file, not in memory
+		return cmdexec.NewTempFileRecorder(true)
+	default: //for non-file response, content can be saved into in-memory buffer
+		return cmdexec.NewTextRecorder(), nil
 	}
 }
 
@@ -161,17 +225,17 @@ func (self *requestContext) parseRequest(descriptor HttpMethodDescriptor, respon
 	}
 	if contentType, _, err := mime.ParseMediaType(contentType); err == nil {
 		if err := self.parseArguments(descriptor.QueryParameters(), extractQueryParameters); err != nil {//parse query parameters
-			convertToHttpError(err, response)
+			writeError(err, self.Request, response)
 			return false
 		} else if err := self.parseArguments(descriptor.RequestHeaders(), extractHeaders); err != nil {//parse headers
-			convertToHttpError(err, response)
+			writeError(err, self.Request, response)
 			return false
-		} else if err := self.parseRequestBody(descriptor.Request(), contentType); err != nil {//parse request body
-			convertToHttpError(err, response)
+		} else if err := self.readRequestBody(descriptor, contentType); err != nil {//parse request body
+			writeError(err, self.Request, response)
 			return false
 		}
 	} else {
-		http.Error(response, err.Error(), http.StatusBadRequest)
+		writeError(newProblem(http.StatusBadRequest, err.Error()), self.Request, response)
 		return false
 	}
 	return true
@@ -180,65 +244,104 @@ func (self *requestContext) parseRequest(descriptor HttpMethodDescriptor, respon
 func (self *requestContext) handleRequest(endpoint Endpoint, response http.ResponseWriter) {
 	//parse path arguments
 	if err := self.parseArguments(endpoint.PathParameters(), mux.Vars); err != nil {
-		http.Error(response, fmt.Sprintf("Incorrect path arguments. Error: %s", err.Error()), http.StatusBadRequest)
+		writeError(err, self.Request, response)
+		return
 	}
 	method := endpoint.GetMethodDescriptor(self.Method)
 	if method == nil {
-		http.Error(response, fmt.Sprintf("Method %s is not supported", self.Method), http.StatusMethodNotAllowed)
+		writeError(newProblem(http.StatusMethodNotAllowed, fmt.Sprintf("Method %s is not supported", self.Method)), self.Request, response)
 	} else if self.parseRequest(method, response) {//prepare execution arguments
 		//execute command-line tool
 		if successResponse, ok := method.Response()[0]; ok { //success response always associated with zero exit code
-			response.Header().Set(headerContentType, successResponse.MimeType)
-			var receiver cmdexec.ExecutionResultRecorder
-			//select buffer for output according with response type
-			switch successResponse.Body.(type) {
-			case FileParameter: //for file response result should be saved into temporary file, not in memory
-				if tempFile, err := cmdexec.NewTempFileRecorder(true); err == nil {
-					receiver = tempFile
-				} else {
-					convertToHttpError(err, response)
+			if method.HasOption(OptionSandbox) {
+				if err := self.createSandbox(); err != nil {
+					writeError(err, self.Request, response)
 					return
 				}
-			default: //for non-file response, content can be saved into in-memory buffer
-				receiver = cmdexec.NewTextRecorder()
 			}
-			self.deferClose(receiver) //ensure that response buffer will be closed
-			//now execute command
-			if err := method.Executor()(self.args, receiver); err == nil {
+			collect, err := self.prepareOutput(successResponse)
+			if err != nil {
+				writeError(err, self.Request, response)
+				return
+			}
+			if method.HasOption(OptionAsync) {
+				self.startJob(method, successResponse, collect, response)
+				return
+			} else if collect == nil && isEventStream(successResponse.MimeType) { //response body produced by the process as a file cannot be streamed
+				self.streamEvents(method, successResponse, response)
+				return
+			} else if collect == nil && method.HasOption(OptionStreaming) {
+				self.streamResponse(method, successResponse, response)
+				return
+			}
+			response.Header().Set(headerContentType, successResponse.MimeType)
+			var receiver cmdexec.ExecutionResultRecorder
+			var stdout io.Writer
+			if collect != nil { //stdout is ignored because response body is produced by the process
+				stdout = ioutil.Discard
+			} else if receiver, err = newReceiver(successResponse); err == nil {
+				self.deferClose(receiver) //ensure that response buffer will be closed
+				stdout = receiver
+			} else {
+				writeError(err, self.Request, response)
+				return
+			}
+			//now execute command. The command will be terminated if client closes the connection
+			if err := method.Executor()(self.Context(), self.args, self.stdin, stdout); err == nil {
+				if collect != nil {
+					if receiver, err = collect(); err != nil {
+						writeError(err, self.Request, response)
+						return
+					}
+					self.deferClose(receiver)
+				}
 				//extract content length from execution result
 				response.Header().Set(headerContentLength, strconv.Itoa(receiver.Len()))
 				response.WriteHeader(successResponse.StatusCode)
 				//copy buffer into HTTP response
 				if _, err := receiver.WriteTo(response); err != nil {
-					convertToHttpError(err, response)
+					log.Printf("Failed to write response for request %s %s. Error: %s", self.Method, self.URL, err.Error())
 				}
 			} else {
 				switch err := err.(type) {
 				case *cmdexec.ExecutionError:
-					if resp, exists := method.Response()[err.ProcessExitCode]; exists {
-						response.Header().Set(headerContentType, resp.MimeType)
-						http.Error(response, err.Error(), resp.StatusCode)
+					if resp, exists := method.Response()[err.ProcessExitCode]; exists && resp.ErrorDetails {
+						self.writeErrorDetails(err, resp.StatusCode, response)
+					} else if exists {
+						writeError(newExecutionProblem(err, resp.StatusCode), self.Request, response)
+					} else if err.ProcessExitCode == cmdexec.ExitCodeTimeout {
+						writeError(newExecutionProblem(err, http.StatusGatewayTimeout), self.Request, response)
 					} else {
-						http.Error(response, err.Error(), http.StatusInternalServerError)
+						writeError(newExecutionProblem(err, http.StatusInternalServerError), self.Request, response)
 					}
 				default:
-					convertToHttpError(err, response)
+					if self.Context().Err() != nil { //nobody is waiting for response
+						log.Printf("Request %s %s is cancelled. Reason: %s", self.Method, self.URL, self.Context().Err())
+					} else {
+						writeError(err, self.Request, response)
+					}
 				}
 			}
 		} else {
-			http.Error(response, "There is no status code associated with process exit code 0", http.StatusInternalServerError)
+			writeError(newProblem(http.StatusInternalServerError, "There is no status code associated with process exit code 0"), self.Request, response)
 		}
 	}
 }
 
-//creates HTTP handler for the specified endpoint
+//creates HTTP handler for the specified endpoint.
+//Methods with asynchronous execution are not supported by this handler
 func CreateEndpointHandler(endpoint Endpoint) http.HandlerFunc {
+	return createEndpointHandler(endpoint, nil)
+}
+
+func createEndpointHandler(endpoint Endpoint, jobs *jobRegistry) http.HandlerFunc {
 	return func(response http.ResponseWriter, request *http.Request) {
 		//initialize logical operation context
 		ctx := &requestContext{
 			deferredActions: make([]core.DeferredAction, 0, 3),
 			Request: request,
 			args: cmdexec.NewArguments(),
+			jobs: jobs,
 			}
 		defer ctx.finalize()	//ensure that context will be closed
 		ctx.handleRequest(endpoint, response)
@@ -255,22 +358,42 @@ func getAllowedMethods(endpoint Endpoint) []string {
 	return methods
 }
 
-func prepareRouter(router *mux.Router, model Model) {
+func prepareRouter(router *mux.Router, model Model, openAPIPath string) {
 	log.Printf("Starting REST service %s", model.Name())
+	var jobs *jobRegistry
+	if hasAsyncMethods(model) {
+		jobs = newJobRegistry(MaxJobs)
+		jobs.register(router)
+	}
 	for path, endpoint := range model.Endpoints() {
 		router.NewRoute().
 			Path(path).
 			Methods(getAllowedMethods(endpoint)...).
-			HandlerFunc(CreateEndpointHandler(endpoint))
+			HandlerFunc(createEndpointHandler(endpoint, jobs))
+	}
+	if len(openAPIPath) > 0 {
+		log.Printf("OpenAPI document is available at %s", openAPIPath)
+		router.NewRoute().
+			Path(openAPIPath).
+			Methods(http.MethodGet).
+			HandlerFunc(createOpenAPIHandler(model))
+	}
+}
+
+func (self *StandaloneServer) listen() (net.Listener, error) {
+	if len(self.Addr) == 0 {
+		return net.Listen("tcp", ":http")
+	} else {
+		return net.Listen("tcp", self.Addr)
 	}
 }
 
-func (self *StandaloneServer) run() error {
+func (self *StandaloneServer) run(listener net.Listener) error {
 	//start HTTP server
 	if self.CertFile != "" && self.KeyFile != "" {
-		return self.ListenAndServeTLS(self.CertFile, self.KeyFile)
+		return self.ServeTLS(listener, self.CertFile, self.KeyFile)
 	} else {
-		return self.ListenAndServe()
+		return self.Serve(listener)
 	}
 }
 
@@ -280,14 +403,17 @@ func (self *StandaloneServer) Run(async bool) error {
 		return errors.New("REST model is not defined")
 	} else {
 		router := mux.NewRouter()
-		prepareRouter(router, self.Model)
+		prepareRouter(router, self.Model, self.OpenAPIPath)
 		self.Handler = router
 	}
-	if async {
-		go self.run()
+	//listener is opened synchronously so the server is able to accept connections after return from this method
+	if listener, err := self.listen(); err != nil {
+		return err
+	} else if async {
+		go self.run(listener)
 		return nil
 	} else {
-		return self.run()
+		return self.run(listener)
 	}
 }
 
@@ -0,0 +1,203 @@
+package rest
+
+import (
+	"io"
+	"bytes"
+	"fmt"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"github.com/sakno/go2rest/cmdexec"
+)
+
+const (
+	headerTrailer = "Trailer"
+	headerCacheControl = "Cache-Control"
+	mimeEventStream = "text/event-stream"
+	mimeNDJSON = "application/x-ndjson"
+	eventOutput = "output"
+	eventExit = "exit"
+	trailerExitCode = "X-Exit-Code"	//exit code of the process
+	trailerError = "X-Error"	//description of the failure
+	maxTrailerStderrSize = 256	//maximum number of bytes from the end of stderr reported in trailer
+)
+
+//writer which sends each portion of data to the client immediately
+type flushWriter struct {
+	output io.Writer
+	flusher http.Flusher
+}
+
+func newFlushWriter(response http.ResponseWriter) *flushWriter {
+	flusher, _ := response.(http.Flusher)
+	return &flushWriter{output: response, flusher: flusher}
+}
+
+func (self *flushWriter) Write(p []byte) (int, error) {
+	written, err := self.output.Write(p)
+	if self.flusher != nil {
+		self.flusher.Flush()
+	}
+	return written, err
+}
+
+//executes command and writes its output directly into HTTP response using chunked transfer encoding.
+//Status code is sent before execution, exit code of the process is reported in HTTP trailer
+func (self *requestContext) streamResponse(method HttpMethodDescriptor, successResponse ResponseDescriptor, response http.ResponseWriter) {
+	response.Header().Set(headerTrailer, trailerExitCode + ", " + trailerError)
+	response.Header().Set(headerContentType, successResponse.MimeType)
+	self.enableFullDuplex(response)
+	response.WriteHeader(successResponse.StatusCode)
+	switch err := method.Executor()(self.Context(), self.args, self.stdin, newFlushWriter(response)).(type) {
+	case nil:
+		response.Header().Set(trailerExitCode, "0")
+	case *cmdexec.ExecutionError:
+		response.Header().Set(trailerExitCode, strconv.Itoa(err.ProcessExitCode))
+		response.Header().Set(trailerError, describeFailure(err))
+	default:
+		log.Printf("Failed to execute command for request %s %s. Error: %s", self.Method, self.URL, err.Error())
+		response.Header().Set(trailerError, strings.Join(strings.Fields(err.Error()), " "))
+	}
+}
+
+//short description of the failed command suitable for HTTP trailer.
+//Full content of stderr is not included because it may be too large for HTTP header
+func describeFailure(err *cmdexec.ExecutionError) string {
+	var message string
+	if err.ProcessExitCode == cmdexec.ExitCodeTimeout {
+		message = fmt.Sprintf("Command %s at stage %v was killed because of timeout", err.Command, err.Stage)
+	} else {
+		message = fmt.Sprintf("Command %s at stage %v exited with code %v", err.Command, err.Stage, err.ProcessExitCode)
+	}
+	if stderr := err.Stderr(); len(stderr) > maxTrailerStderrSize {
+		message += ": ..." + strings.ToValidUTF8(stderr[len(stderr) - maxTrailerStderrSize:], "")
+	} else if len(stderr) > 0 {
+		message += ": " + stderr
+	}
+	return strings.Join(strings.Fields(message), " ")
+}
+
+//writer which splits output into lines
+type lineWriter struct {
+	buffer bytes.Buffer
+	emit func(line []byte) error
+}
+
+func (self *lineWriter) Write(p []byte) (int, error) {
+	self.buffer.Write(p)
+	for {
+		data := self.buffer.Bytes()
+		if index := bytes.IndexByte(data, '\n'); index >= 0 {
+			if err := self.emit(bytes.TrimSuffix(data[:index], []byte{'\r'})); err != nil {
+				return 0, err
+			}
+			self.buffer.Next(index + 1)
+		} else {
+			return len(p), nil
+		}
+	}
+}
+
+//emits the last line without line terminator
+func (self *lineWriter) Close() error {
+	if self.buffer.Len() > 0 {
+		defer self.buffer.Reset()
+		return self.emit(self.buffer.Bytes())
+	} else {
+		return nil
+	}
+}
+
+//the last event in the stream of events
+type completionEvent struct {
+	ExitCode int `json:"exitCode"`
+	Stderr string `json:"stderr,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+func newCompletionEvent(err error) *completionEvent {
+	switch err := err.(type) {
+	case nil:
+		return &completionEvent{ExitCode: 0}
+	case *cmdexec.ExecutionError:
+		return &completionEvent{ExitCode: err.ProcessExitCode, Stderr: err.Stderr(), Error: err.Error()}
+	default:
+		return &completionEvent{ExitCode: -1, Error: err.Error()}
+	}
+}
+
+//line of output in the form of NDJSON record
+type outputRecord struct {
+	Type string `json:"type"`
+	Data string `json:"data"`
+}
+
+//completion of execution in the form of NDJSON record
+type completionRecord struct {
+	Type string `json:"type"`
+	*completionEvent
+}
+
+//writes each line of output as Server-Sent Event
+func writeServerSentEvent(output io.Writer, line []byte) error {
+	_, err := fmt.Fprintf(output, "data: %s\n\n", line)
+	return err
+}
+
+func writeServerSentCompletion(output io.Writer, event *completionEvent) error {
+	if data, err := json.Marshal(event); err == nil {
+		_, err := fmt.Fprintf(output, "event: %s\ndata: %s\n\n", eventExit, data)
+		return err
+	} else {
+		return err
+	}
+}
+
+//writes each line of output as JSON record
+func writeNDJSONRecord(output io.Writer, line []byte) error {
+	return json.NewEncoder(output).Encode(&outputRecord{Type: eventOutput, Data: string(line)})
+}
+
+func writeNDJSONCompletion(output io.Writer, event *completionEvent) error {
+	return json.NewEncoder(output).Encode(&completionRecord{Type: eventExit, completionEvent: event})
+}
+
+//executes command and sends each line of its output as separated event.
+//The last event contains exit code of the process and content of stderr
+func (self *requestContext) streamEvents(method HttpMethodDescriptor, successResponse ResponseDescriptor, response http.ResponseWriter) {
+	var writeLine func(io.Writer, []byte) error
+	var writeCompletion func(io.Writer, *completionEvent) error
+	switch successResponse.MimeType {
+	case mimeEventStream:
+		writeLine, writeCompletion = writeServerSentEvent, writeServerSentCompletion
+	default:
+		writeLine, writeCompletion = writeNDJSONRecord, writeNDJSONCompletion
+	}
+	response.Header().Set(headerContentType, successResponse.MimeType)
+	response.Header().Set(headerCacheControl, "no-cache")
+	self.enableFullDuplex(response)
+	response.WriteHeader(successResponse.StatusCode)
+	output := newFlushWriter(response)
+	lines := &lineWriter{emit: func(line []byte) error { return writeLine(output, line) }}
+	err := method.Executor()(self.Context(), self.args, self.stdin, lines)
+	if err == nil {
+		err = lines.Close()
+	} else {
+		lines.Close()
+	}
+	if err := writeCompletion(output, newCompletionEvent(err)); err != nil {
+		log.Printf("Failed to complete stream of events for request %s %s. Error: %s", self.Method, self.URL, err.Error())
+	}
+}
+
+//indicates that output of the process should be represented as stream of events
+func isEventStream(mimeType string) bool {
+	switch mimeType {
+	case mimeEventStream, mimeNDJSON:
+		return true
+	default:
+		return false
+	}
+}